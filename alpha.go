@@ -0,0 +1,219 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+)
+
+// WithTransparentIndex reserves the given palette index for transparent pixels.
+// An index beyond the end of the palette reserves the last entry instead.
+func WithTransparentIndex(i uint8) option {
+	return func(o *encodeOptions) {
+		o.transparent = true
+		o.transparentIndex = int(i)
+	}
+}
+
+// WithAlphaThreshold reserves a palette entry for transparent pixels and maps all pixels
+// with an alpha value below the given threshold to it.
+func WithAlphaThreshold(a uint8) option {
+	return func(o *encodeOptions) {
+		o.transparent = true
+		o.alphaThreshold = int(a)
+	}
+}
+
+// WithAlphaDither reserves a palette entry for transparent pixels and uses an ordered dither
+// to approximate partial transparency, rather than a fixed alpha threshold.
+func WithAlphaDither() option {
+	return func(o *encodeOptions) {
+		o.transparent = true
+		o.alphaDither = true
+	}
+}
+
+// WithMatte blends partially transparent pixels that remain opaque against the given
+// background color before quantization.
+func WithMatte(c color.Color) option {
+	return func(o *encodeOptions) {
+		o.matte = c
+	}
+}
+
+// bayer is a 4x4 ordered dither matrix.
+var bayer = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// toPalettedAlpha flattens m to opaque colors, quantizes it and then applies transparency
+// using the reserved palette index.
+func toPalettedAlpha(m image.Image, opts *encodeOptions) *image.Paletted {
+	b := m.Bounds()
+	flat := image.NewRGBA(b)
+	var mask []bool
+	if opts.transparent {
+		mask = make([]bool, b.Dx()*b.Dy())
+	}
+
+	i, j := 0, 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, a := opts.flatten(m.At(x, y))
+			if opts.transparent {
+				mask[j] = opts.transparentAt(x, y, a)
+			}
+			flat.Pix[i+0] = c.R
+			flat.Pix[i+1] = c.G
+			flat.Pix[i+2] = c.B
+			flat.Pix[i+3] = 0xff
+			i += 4
+			j++
+		}
+	}
+
+	n := opts.NumColors
+	if opts.transparent {
+		n--
+	}
+	pal := palette.Plan9[:n]
+	if opts.Quantizer != nil {
+		// transparent pixels are excluded so they don't take up palette entries
+		var src image.Image = flat
+		if opts.transparent {
+			src = unmasked(flat, mask)
+		}
+		pal = opts.Quantizer.Quantize(make(color.Palette, 0, n), src)
+	}
+	pm := image.NewPaletted(b, pal)
+	opts.Drawer.Draw(pm, b, flat, b.Min)
+	if !opts.transparent {
+		return pm
+	}
+
+	ti := opts.transparentIndex
+	if ti < 0 || ti > len(pal) {
+		ti = len(pal)
+	}
+	p := make(color.Palette, 0, len(pal)+1)
+	p = append(p, pal[:ti]...)
+	p = append(p, color.Transparent)
+	pm.Palette = append(p, pal[ti:]...)
+	for i, c := range pm.Pix {
+		if mask[i] {
+			pm.Pix[i] = uint8(ti)
+		} else if int(c) >= ti {
+			pm.Pix[i]++
+		}
+	}
+	return pm
+}
+
+// unmasked returns the pixels of m whose mask entry is false, packed into a single row.
+func unmasked(m *image.RGBA, mask []bool) *image.RGBA {
+	n := 0
+	for _, t := range mask {
+		if !t {
+			n++
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, n, 1))
+	j := 0
+	for i, t := range mask {
+		if !t {
+			copy(dst.Pix[j:j+4], m.Pix[4*i:4*i+4])
+			j += 4
+		}
+	}
+	return dst
+}
+
+// palettedAlpha applies transparency and matting to the palette of pm, keeping its colors
+// exact, or returns nil if there is no room for a transparent entry. An existing fully
+// transparent entry is reused, unless WithTransparentIndex asks for another index.
+func palettedAlpha(pm *image.Paletted, opts *encodeOptions) *image.Paletted {
+	var alphas [256]uint32
+	pal := make(color.Palette, len(pm.Palette))
+	for i, c := range pm.Palette {
+		pal[i], alphas[i] = opts.flatten(c)
+	}
+	if !opts.transparent {
+		dup := *pm
+		dup.Palette = pal
+		return &dup
+	}
+	if ti := findTransparent(pm.Palette); ti >= 0 && (opts.transparentIndex < 0 || opts.transparentIndex == ti) {
+		pal[ti] = color.Transparent
+		dst := image.NewPaletted(pm.Rect, pal)
+		i := 0
+		for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+			for x := pm.Rect.Min.X; x < pm.Rect.Max.X; x++ {
+				c := pm.ColorIndexAt(x, y)
+				if int(c) == ti || opts.transparentAt(x, y, alphas[c]) {
+					dst.Pix[i] = uint8(ti)
+				} else {
+					dst.Pix[i] = c
+				}
+				i++
+			}
+		}
+		return dst
+	}
+	if len(pal) >= opts.NumColors {
+		return nil
+	}
+
+	ti := opts.transparentIndex
+	if ti < 0 || ti > len(pal) {
+		ti = len(pal)
+	}
+	p := make(color.Palette, 0, len(pal)+1)
+	p = append(p, pal[:ti]...)
+	p = append(p, color.Transparent)
+	dst := image.NewPaletted(pm.Rect, append(p, pal[ti:]...))
+	i := 0
+	for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+		for x := pm.Rect.Min.X; x < pm.Rect.Max.X; x++ {
+			c := pm.ColorIndexAt(x, y)
+			if opts.transparentAt(x, y, alphas[c]) {
+				dst.Pix[i] = uint8(ti)
+			} else if int(c) >= ti {
+				dst.Pix[i] = c + 1
+			} else {
+				dst.Pix[i] = c
+			}
+			i++
+		}
+	}
+	return dst
+}
+
+// flatten returns the opaque color that c is drawn as, blended against any matte, along with
+// its original alpha.
+func (o *encodeOptions) flatten(c color.Color) (color.RGBA, uint32) {
+	r, g, b, a := c.RGBA()
+	if o.matte != nil {
+		mr, mg, mb, _ := o.matte.RGBA()
+		r += mr * (0xffff - a) / 0xffff
+		g += mg * (0xffff - a) / 0xffff
+		b += mb * (0xffff - a) / 0xffff
+	} else if a > 0 && a < 0xffff {
+		r = r * 0xffff / a
+		g = g * 0xffff / a
+		b = b * 0xffff / a
+	}
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}, a
+}
+
+// transparentAt reports whether a pixel at the given position with the given alpha is
+// mapped to the transparent entry.
+func (o *encodeOptions) transparentAt(x, y int, a uint32) bool {
+	threshold := uint32(o.alphaThreshold) * 0x101
+	if o.alphaDither {
+		threshold = (2*bayer[y&3][x&3] + 1) * 0xffff / 32
+	}
+	return a < threshold
+}
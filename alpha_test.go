@@ -0,0 +1,174 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestAlphaThreshold(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 16, 1))
+	for x := 0; x < 16; x++ {
+		m.SetNRGBA(x, 0, color.NRGBA{R: 0xff, A: uint8(x * 0x11)})
+	}
+
+	for _, tc := range []struct {
+		opts  []option
+		index uint8
+		want  int
+	}{
+		{[]option{WithTransparentIndex(0)}, 0, 8},
+		{[]option{WithAlphaThreshold(0x40)}, 255, 4},
+		{[]option{WithTransparentIndex(3), WithAlphaThreshold(0xff), WithNumColors(4)}, 3, 15},
+	} {
+		buf := &bytes.Buffer{}
+		if err := NewEncoder(buf).EncodeImage(m, tc.opts...); err != nil {
+			t.Fatal("EncodeImage:", err)
+		}
+		pm, err := Decode(buf)
+		if err != nil {
+			t.Fatal("Decode:", err)
+		}
+		p := pm.(*image.Paletted)
+		if _, _, _, a := p.Palette[tc.index].RGBA(); a != 0 {
+			t.Fatal("transparent index not reserved:", tc.index, p.Palette)
+		}
+		n := 0
+		for _, c := range p.Pix {
+			if c == tc.index {
+				n++
+			}
+		}
+		if n != tc.want {
+			t.Fatal("unexpected transparent pixel count: got:", n, "want:", tc.want)
+		}
+	}
+}
+
+func TestAlphaDither(t *testing.T) {
+	m := image.NewUniform(color.NRGBA{G: 0xff, A: 0x80})
+	r := image.Rect(0, 0, 8, 8)
+	pm := toPalettedAlpha(uniformImage{m, r}, newEncodeOptions([]option{WithAlphaDither()}))
+	n := 0
+	for _, c := range pm.Pix {
+		if int(c) == len(pm.Palette)-1 {
+			n++
+		}
+	}
+	if n != 32 {
+		t.Fatal("unexpected transparent pixel count: got:", n, "want:", 32)
+	}
+}
+
+func TestMatte(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	m.SetNRGBA(0, 0, color.NRGBA{R: 0xff, A: 0x80})
+	pm := toPalettedAlpha(m, newEncodeOptions([]option{WithMatte(color.White), WithNumColors(256)}))
+	r, g, b, _ := pm.At(0, 0).RGBA()
+	if r>>8 < 0xc0 || g>>8 < 0x60 || g>>8 > 0xa0 || g != b {
+		t.Fatal("unexpected matte color:", pm.At(0, 0))
+	}
+}
+
+func TestPalettedAlpha(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	half := color.NRGBA{G: 0xff, A: 0x80}
+	m := image.NewPaletted(image.Rect(0, 0, 3, 1), color.Palette{red, half, color.Transparent})
+	m.Pix = []uint8{0, 1, 2}
+
+	for _, tc := range []struct {
+		opts []option
+		want [3]color.Color
+	}{
+		{[]option{WithTransparentIndex(0)}, [3]color.Color{red, color.RGBA{G: 0xff, A: 0xff}, color.RGBA{}}},
+		{[]option{WithAlphaThreshold(0xff)}, [3]color.Color{red, color.RGBA{}, color.RGBA{}}},
+		{[]option{WithMatte(color.White)}, [3]color.Color{red, color.RGBA{R: 0x7f, G: 0xff, B: 0x7f, A: 0xff}, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}}},
+	} {
+		buf := &bytes.Buffer{}
+		if err := NewEncoder(buf).EncodeImage(m, tc.opts...); err != nil {
+			t.Fatal("EncodeImage:", err)
+		}
+		got, err := Decode(buf)
+		if err != nil {
+			t.Fatal("Decode:", err)
+		}
+		for x, want := range tc.want {
+			if c := got.At(x, 0); colorKey(c) != colorKey(want) {
+				t.Fatal("pixel", x, "got:", c, "want:", want)
+			}
+		}
+	}
+
+	// a full palette has no room for the transparent entry, so is quantized instead
+	full := image.NewPaletted(m.Rect, make(color.Palette, 256))
+	for i := range full.Palette {
+		full.Palette[i] = color.Gray{Y: uint8(i)}
+	}
+	full.Palette[1] = color.Transparent
+	full.Pix = []uint8{0, 1, 255}
+	pm := toPaletted(full, newEncodeOptions([]option{WithTransparentIndex(0)}))
+	if len(pm.Palette) > 256 || pm.Pix[1] != 0 || pm.Palette[0] != color.Transparent {
+		t.Fatal("unexpected quantized image:", len(pm.Palette), pm.Pix)
+	}
+}
+
+func TestPalettedAlphaReusesTransparent(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	m := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{red, color.Transparent})
+	m.Pix = []uint8{0, 1}
+	pm := palettedAlpha(m, newEncodeOptions([]option{WithAlphaThreshold(0x80)}))
+	if len(pm.Palette) != 2 || pm.Pix[1] != 1 {
+		t.Fatal("transparent entry not reused:", pm.Palette, pm.Pix)
+	}
+
+	// a full palette with a transparent entry keeps its colors
+	full := image.NewPaletted(m.Rect, make(color.Palette, 256))
+	for i := range full.Palette {
+		full.Palette[i] = color.Gray{Y: uint8(i)}
+	}
+	full.Palette[1] = color.Transparent
+	full.Pix = []uint8{0, 1}
+	pm = toPaletted(full, newEncodeOptions([]option{WithAlphaThreshold(0x80)}))
+	if len(pm.Palette) != 256 || pm.Pix[0] != 0 || pm.Pix[1] != 1 || pm.Palette[1] != color.Transparent {
+		t.Fatal("unexpected image:", len(pm.Palette), pm.Pix)
+	}
+}
+
+// spyQuantizer records the colors of the image it quantizes.
+type spyQuantizer struct {
+	colors map[color.RGBA]bool
+}
+
+func (q *spyQuantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+			q.colors[c] = true
+			p = append(p, c)
+		}
+	}
+	return p[:min(len(p), cap(p))]
+}
+
+func TestAlphaQuantizer(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	m.SetNRGBA(0, 0, color.NRGBA{R: 0xff, A: 0x10})
+	m.SetNRGBA(1, 0, color.NRGBA{G: 0xff, A: 0xff})
+	q := &spyQuantizer{colors: make(map[color.RGBA]bool)}
+	toPalettedAlpha(m, newEncodeOptions([]option{WithAlphaThreshold(0x80), WithQuantizer(q)}))
+	if want := map[color.RGBA]bool{{G: 0xff, A: 0xff}: true}; !reflect.DeepEqual(q.colors, want) {
+		t.Fatal("unexpected quantized colors: got:", q.colors, "want:", want)
+	}
+}
+
+type uniformImage struct {
+	*image.Uniform
+	r image.Rectangle
+}
+
+func (u uniformImage) Bounds() image.Rectangle {
+	return u.r
+}
@@ -0,0 +1,501 @@
+package gif
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"time"
+)
+
+// The APNG format is specified at https://wiki.mozilla.org/APNG_Specification.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// APNG dispose and blend operations.
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+	apngBlendOver         = 1
+)
+
+// GIFToAPNG converts the GIF stream read by dec to an animated PNG written to w. Each frame keeps
+// its bounds, delay and disposal method, which map directly to APNG frame control chunks, and
+// is stored as 8-bit RGBA compressed by image/png. Plain text extensions are rendered into
+// frames, while other extensions are dropped. As the frame count precedes the image data in an
+// APNG, compressed frames are held in memory until the GIF trailer is read.
+func GIFToAPNG(w io.Writer, dec *Decoder) error {
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+	screen := image.Rect(0, 0, hdr.Config.Width, hdr.Config.Height)
+	if screen.Empty() {
+		return errors.New("gif: invalid APNG dimensions")
+	}
+	gp, _ := hdr.Config.ColorModel.(color.Palette)
+
+	aw := &apngWriter{screen: screen}
+	aw.enc.BufferPool = &pngBufferPool{}
+	loopCount := -1
+	for {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch blk := blk.(type) {
+		case *Frame:
+			err = aw.frame(blk)
+		case *PlainText:
+			err = aw.frame(blk.Frame(gp))
+		case *ApplicationNetscape:
+			loopCount = blk.LoopCount
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if aw.frames == 0 {
+		return errors.New("gif: missing image data")
+	}
+
+	plays := uint32(1)
+	if loopCount == 0 {
+		plays = 0
+	} else if loopCount > 0 {
+		plays = uint32(loopCount) + 1
+	}
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(screen.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(screen.Dy()))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+	var actl [8]byte
+	binary.BigEndian.PutUint32(actl[0:4], aw.frames)
+	binary.BigEndian.PutUint32(actl[4:8], plays)
+
+	if _, err := io.WriteString(w, pngSignature); err != nil {
+		return err
+	}
+	if err := writeChunk(w, "IHDR", ihdr[:]); err != nil {
+		return err
+	}
+	if err := writeChunk(w, "acTL", actl[:]); err != nil {
+		return err
+	}
+	if _, err := aw.chunks.WriteTo(w); err != nil {
+		return err
+	}
+	return writeChunk(w, "IEND", nil)
+}
+
+type apngWriter struct {
+	screen image.Rectangle
+	enc    png.Encoder
+	png    bytes.Buffer // a single frame encoded by enc
+	chunks bytes.Buffer // frame control and data chunks
+	seq    uint32
+	frames uint32
+}
+
+func (aw *apngWriter) frame(f *Frame) error {
+	pm := f.Image
+	r := pm.Rect.Intersect(aw.screen)
+	dispose := byte(apngDisposeNone)
+	switch f.DisposalMethod {
+	case DisposalBackground:
+		dispose = apngDisposeBackground
+	case DisposalPrevious:
+		dispose = apngDisposePrevious
+	}
+	if aw.frames == 0 {
+		// the first frame must cover the canvas, which starts out transparent
+		r = aw.screen
+		if dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+	} else if r.Empty() {
+		// frames can't be empty, so draw a single transparent pixel instead
+		r = image.Rect(0, 0, 1, 1)
+	}
+
+	colors := make([]color.NRGBA, len(pm.Palette))
+	for i, c := range pm.Palette {
+		colors[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+	m := image.NewNRGBA(r)
+	vis := r.Intersect(pm.Rect)
+	for y := vis.Min.Y; y < vis.Max.Y; y++ {
+		i := pm.PixOffset(vis.Min.X, y)
+		j := m.PixOffset(vis.Min.X, y)
+		for x := vis.Min.X; x < vis.Max.X; x++ {
+			if idx := int(pm.Pix[i]); idx < len(colors) {
+				c := colors[idx]
+				m.Pix[j+0], m.Pix[j+1], m.Pix[j+2], m.Pix[j+3] = c.R, c.G, c.B, c.A
+			}
+			i++
+			j += 4
+		}
+	}
+	aw.png.Reset()
+	if err := aw.enc.Encode(&aw.png, translucent{m}); err != nil {
+		return err
+	}
+
+	var fctl [26]byte
+	binary.BigEndian.PutUint32(fctl[0:4], aw.seq)
+	binary.BigEndian.PutUint32(fctl[4:8], uint32(r.Dx()))
+	binary.BigEndian.PutUint32(fctl[8:12], uint32(r.Dy()))
+	binary.BigEndian.PutUint32(fctl[12:16], uint32(r.Min.X))
+	binary.BigEndian.PutUint32(fctl[16:20], uint32(r.Min.Y))
+	binary.BigEndian.PutUint16(fctl[20:22], uint16(min(f.DelayTime/(10*time.Millisecond), math.MaxUint16)))
+	binary.BigEndian.PutUint16(fctl[22:24], 100)
+	fctl[24] = dispose
+	fctl[25] = apngBlendOver
+	if err := writeChunk(&aw.chunks, "fcTL", fctl[:]); err != nil {
+		return err
+	}
+	aw.seq++
+
+	pr := bytes.NewReader(aw.png.Bytes()[len(pngSignature):])
+	for {
+		typ, data, err := readChunk(pr)
+		if err != nil {
+			return err
+		}
+		if typ == "IEND" {
+			break
+		} else if typ != "IDAT" {
+			continue
+		}
+		if aw.frames == 0 {
+			// the first frame doubles as the default image
+			err = writeChunk(&aw.chunks, "IDAT", data)
+		} else {
+			err = writeChunk(&aw.chunks, "fdAT", binary.BigEndian.AppendUint32(nil, aw.seq), data)
+			aw.seq++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	aw.frames++
+	return nil
+}
+
+// translucent makes image/png always use 8-bit RGBA, since every APNG frame must share the color
+// type declared in the IHDR chunk.
+type translucent struct {
+	*image.NRGBA
+}
+
+func (translucent) Opaque() bool {
+	return false
+}
+
+// pngBufferPool lets image/png reuse its compressor between frames.
+type pngBufferPool struct {
+	b *png.EncoderBuffer
+}
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	return p.b
+}
+
+func (p *pngBufferPool) Put(b *png.EncoderBuffer) {
+	p.b = b
+}
+
+// APNGToGIF converts the animated PNG read from r to a GIF written to enc. Frames are composited
+// according to their APNG dispose and blend operations, then quantized with stable palettes of
+// at most numColors entries, where pixels less than half opaque become transparent, and
+// re-optimized. Frame data is decoded by image/png one frame at a time, so only the canvas and
+// the current frame are held in memory. A PNG without animation becomes a single frame.
+func APNGToGIF(enc *Encoder, r io.Reader, numColors int) error {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	sig := make([]byte, len(pngSignature))
+	if err := readFull(r, sig); err != nil {
+		return err
+	}
+	if string(sig) != pngSignature {
+		return errors.New("gif: not a PNG file")
+	}
+
+	ar := &apngReader{enc: enc, q: NewAnimationQuantizer(numColors)}
+	ar.q.Transparent = true
+	for {
+		typ, data, err := readChunk(r)
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case "IHDR":
+			if len(data) != 13 {
+				return errors.New("gif: invalid PNG header")
+			}
+			ar.ihdr = data
+			w, h := binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])
+			if w < 1 || h < 1 || w > math.MaxUint16 || h > math.MaxUint16 {
+				return errors.New("gif: invalid APNG dimensions")
+			}
+			ar.canvas = image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+		case "PLTE", "tRNS":
+			// needed to decode the data of every frame
+			ar.meta = append(ar.meta, chunk{typ, data})
+		case "acTL":
+			if len(data) != 8 {
+				return errors.New("gif: invalid APNG animation control")
+			}
+			ar.animated = true
+			ar.plays = binary.BigEndian.Uint32(data[4:8])
+		case "fcTL":
+			if err := ar.flush(); err != nil {
+				return err
+			}
+			if err := ar.control(data); err != nil {
+				return err
+			}
+		case "IDAT":
+			if ar.canvas == nil {
+				return errors.New("gif: missing PNG header")
+			}
+			if !ar.animated && !ar.pending {
+				ar.fc = apngFrame{rect: ar.canvas.Rect}
+				ar.pending = true
+			}
+			if ar.pending && !ar.fdat {
+				// otherwise the default image isn't part of the animation
+				ar.data.Write(data)
+			}
+		case "fdAT":
+			if len(data) < 4 {
+				return errors.New("gif: invalid APNG frame data")
+			}
+			if ar.pending {
+				ar.fdat = true
+				ar.data.Write(data[4:])
+			}
+		case "IEND":
+			if err := ar.flush(); err != nil {
+				return err
+			}
+			if ar.frames == 0 {
+				return errors.New("gif: missing image data")
+			}
+			if err := ar.w.flush(context.Background()); err != nil {
+				return err
+			}
+			if err := enc.WriteTrailer(); err != nil {
+				return err
+			}
+			return enc.Flush()
+		}
+	}
+}
+
+type chunk struct {
+	typ  string
+	data []byte
+}
+
+// apngFrame holds the fields of a frame control chunk.
+type apngFrame struct {
+	rect    image.Rectangle
+	delay   time.Duration
+	dispose byte
+	blend   byte
+}
+
+type apngReader struct {
+	enc      *Encoder
+	q        *AnimationQuantizer
+	c        *Coalescer
+	w        *frameWriter
+	ihdr     []byte
+	meta     []chunk // chunks needed to decode frame data
+	animated bool
+	plays    uint32
+	canvas   *image.RGBA
+	frames   int
+
+	// The frame whose data is being read.
+	fc      apngFrame
+	pending bool
+	fdat    bool // the data is in fdAT rather than IDAT chunks
+	data    bytes.Buffer
+	png     bytes.Buffer
+}
+
+func (ar *apngReader) control(data []byte) error {
+	if len(data) != 26 {
+		return errors.New("gif: invalid APNG frame control")
+	}
+	if ar.canvas == nil {
+		return errors.New("gif: missing PNG header")
+	}
+	w, h := binary.BigEndian.Uint32(data[4:8]), binary.BigEndian.Uint32(data[8:12])
+	x, y := binary.BigEndian.Uint32(data[12:16]), binary.BigEndian.Uint32(data[16:20])
+	if w < 1 || h < 1 || uint64(x)+uint64(w) > uint64(ar.canvas.Rect.Dx()) || uint64(y)+uint64(h) > uint64(ar.canvas.Rect.Dy()) {
+		return errors.New("gif: APNG frame bounds larger than image bounds")
+	}
+	num, den := binary.BigEndian.Uint16(data[20:22]), binary.BigEndian.Uint16(data[22:24])
+	if den == 0 {
+		den = 100
+	}
+	ar.fc = apngFrame{
+		rect:    image.Rect(int(x), int(y), int(x+w), int(y+h)),
+		delay:   time.Duration(num) * time.Second / time.Duration(den),
+		dispose: data[24],
+		blend:   data[25],
+	}
+	if ar.frames == 0 && ar.fc.dispose == apngDisposePrevious {
+		ar.fc.dispose = apngDisposeBackground
+	}
+	ar.pending, ar.fdat = true, false
+	ar.data.Reset()
+	return nil
+}
+
+// flush decodes the pending frame, draws it on the canvas and writes the result.
+func (ar *apngReader) flush() error {
+	if !ar.pending {
+		return nil
+	}
+	ar.pending = false
+	m, err := ar.decode()
+	if err != nil {
+		return err
+	}
+
+	if ar.frames == 0 {
+		cfg := image.Config{Width: ar.canvas.Rect.Dx(), Height: ar.canvas.Rect.Dy()}
+		// choose a global color table once a few frames have been seen
+		if err := ar.enc.WriteHeaderDeferred(&Header{Config: cfg}, 8); err != nil {
+			return err
+		}
+		if ar.animated && ar.plays != 1 {
+			loopCount := 0
+			if ar.plays > 1 {
+				loopCount = int(min(ar.plays-1, math.MaxUint16))
+			}
+			if err := ar.enc.WriteApplicationNetscape(&ApplicationNetscape{LoopCount: loopCount}); err != nil {
+				return err
+			}
+		}
+		ar.c = NewCoalescer(cfg)
+		ar.w = newFrameWriter(ar.enc, true)
+	}
+	ar.frames++
+
+	r := ar.fc.rect
+	var saved *image.RGBA
+	if ar.fc.dispose == apngDisposePrevious {
+		saved = image.NewRGBA(r)
+		draw.Draw(saved, r, ar.canvas, r.Min, draw.Src)
+	}
+	op := draw.Over
+	if ar.fc.blend == apngBlendSource {
+		op = draw.Src
+	}
+	draw.Draw(ar.canvas, r, m, m.Bounds().Min, op)
+
+	// Every canvas is shown exactly as is, so the Coalescer only keeps the disposals needed to
+	// reveal transparency.
+	f := ar.c.Coalesce(&Frame{Image: ar.q.Quantize(ar.canvas), DelayTime: ar.fc.delay, DisposalMethod: DisposalBackground})
+	if err := ar.w.frame(context.Background(), f); err != nil {
+		return err
+	}
+
+	switch ar.fc.dispose {
+	case apngDisposeBackground:
+		draw.Draw(ar.canvas, r, image.Transparent, image.Point{}, draw.Src)
+	case apngDisposePrevious:
+		draw.Draw(ar.canvas, r, saved, r.Min, draw.Src)
+	}
+	return nil
+}
+
+// decode decodes the pending frame data by wrapping it in a standalone PNG for image/png.
+func (ar *apngReader) decode() (image.Image, error) {
+	ihdr := append([]byte(nil), ar.ihdr...)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(ar.fc.rect.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(ar.fc.rect.Dy()))
+
+	ar.png.Reset()
+	ar.png.WriteString(pngSignature)
+	_ = writeChunk(&ar.png, "IHDR", ihdr)
+	for _, c := range ar.meta {
+		_ = writeChunk(&ar.png, c.typ, c.data)
+	}
+	_ = writeChunk(&ar.png, "IDAT", ar.data.Bytes())
+	_ = writeChunk(&ar.png, "IEND", nil)
+	return png.Decode(&ar.png)
+}
+
+// readChunk reads a PNG chunk and verifies its checksum. The data is buffered as it arrives,
+// so a corrupt length can't force a large allocation on its own.
+func readChunk(r io.Reader) (string, []byte, error) {
+	var hdr [8]byte
+	if err := readFull(r, hdr[:]); err != nil {
+		return "", nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	if n > math.MaxInt32 {
+		return "", nil, errors.New("gif: invalid PNG chunk length")
+	}
+	var data bytes.Buffer
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:8])
+	if _, err := io.CopyN(io.MultiWriter(&data, crc), r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", nil, err
+	}
+	if err := readFull(r, hdr[0:4]); err != nil {
+		return "", nil, err
+	}
+	if crc.Sum32() != binary.BigEndian.Uint32(hdr[0:4]) {
+		return "", nil, errors.New("gif: invalid PNG chunk checksum")
+	}
+	return string(hdr[4:8]), data.Bytes(), nil
+}
+
+// writeChunk writes a PNG chunk whose data is the concatenation of the given slices.
+func writeChunk(w io.Writer, typ string, data ...[]byte) error {
+	n := 0
+	for _, d := range data {
+		n += len(d)
+	}
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(n))
+	copy(hdr[4:8], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:8])
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	for _, d := range data {
+		crc.Write(d)
+		if _, err := w.Write(d); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+	return err
+}
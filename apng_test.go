@@ -0,0 +1,148 @@
+package gif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestAPNG(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	p := color.Palette{black, white, red, color.RGBA{}}
+	f0 := image.NewPaletted(image.Rect(0, 0, 4, 4), p)
+	f1 := image.NewPaletted(image.Rect(1, 1, 3, 3), p)
+	copy(f1.Pix, []uint8{1, 3, 2, 1})
+	f2 := image.NewPaletted(image.Rect(3, 0, 4, 2), p)
+	copy(f2.Pix, []uint8{2, 2})
+	f3 := image.NewPaletted(image.Rect(0, 3, 1, 4), p)
+	f3.Pix[0] = 1
+	g := &GIF{
+		Image:     []*image.Paletted{f0, f1, f2, f3},
+		Delay:     []int{10, 7, 20, 30},
+		Disposal:  []byte{DisposalNone, DisposalBackground, DisposalPrevious, DisposalNone},
+		LoopCount: 2,
+		Config:    image.Config{Width: 4, Height: 4, ColorModel: p},
+	}
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+
+	apng := &bytes.Buffer{}
+	if err := GIFToAPNG(apng, NewDecoder(buf)); err != nil {
+		t.Fatal("GIFToAPNG:", err)
+	}
+
+	// decoders without APNG support show the first frame
+	m, err := png.Decode(bytes.NewReader(apng.Bytes()))
+	if err != nil {
+		t.Fatal("png.Decode:", err)
+	}
+	if m.Bounds() != f0.Rect || colorKey(m.At(0, 0)) != colorKey(black) {
+		t.Fatal("unexpected default image:", m.Bounds(), m.At(0, 0))
+	}
+
+	var controls [][]byte
+	r := bytes.NewReader(apng.Bytes()[len(pngSignature):])
+	for {
+		typ, data, err := readChunk(r)
+		if err != nil {
+			t.Fatal("readChunk:", err)
+		}
+		if typ == "IEND" {
+			break
+		}
+		if typ == "acTL" && (binary.BigEndian.Uint32(data[0:4]) != 4 || binary.BigEndian.Uint32(data[4:8]) != 3) {
+			t.Fatalf("unexpected animation control: %x", data)
+		}
+		if typ == "fcTL" {
+			controls = append(controls, data)
+		}
+	}
+	// width, height, x, y, delay numerator and denominator, dispose and blend operations
+	if len(controls) != 4 {
+		t.Fatal("unexpected frame count:", len(controls))
+	}
+	for i, want := range []string{
+		"00000002000000020000000100000001000700640101",
+		"00000001000000020000000300000000001400640201",
+	} {
+		if got := hex.EncodeToString(controls[i+1][4:]); got != want {
+			t.Fatalf("frame %d control: got %s, want %s", i+1, got, want)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := APNGToGIF(NewEncoder(out), bytes.NewReader(apng.Bytes()), 256); err != nil {
+		t.Fatal("APNGToGIF:", err)
+	}
+	got, err := DecodeAll(out)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if got.LoopCount != g.LoopCount || len(got.Delay) != len(g.Delay) {
+		t.Fatal("unexpected animation:", got.LoopCount, got.Delay)
+	}
+	want := Coalesce(g)
+	have := Coalesce(got)
+	for i := range want.Image {
+		if have.Delay[i] != want.Delay[i] {
+			t.Fatalf("frame %d delay: got %d, want %d", i, have.Delay[i], want.Delay[i])
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				if c0, c1 := have.Image[i].At(x, y), want.Image[i].At(x, y); colorKey(c0) != colorKey(c1) {
+					t.Fatalf("frame %d pixel %d,%d: got %v, want %v", i, x, y, c0, c1)
+				}
+			}
+		}
+	}
+}
+
+func TestAPNGToGIFStill(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	m.Set(1, 1, color.NRGBA{G: 0xff, A: 0xff})
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, m); err != nil {
+		t.Fatal("png.Encode:", err)
+	}
+	out := &bytes.Buffer{}
+	if err := APNGToGIF(NewEncoder(out), buf, 0); err != nil {
+		t.Fatal("APNGToGIF:", err)
+	}
+	g, err := DecodeAll(out)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if len(g.Image) != 1 || g.LoopCount != -1 {
+		t.Fatal("unexpected animation:", len(g.Image), g.LoopCount)
+	}
+	c := Coalesce(g).Image[0]
+	if _, _, _, a := c.At(0, 0).RGBA(); a != 0 {
+		t.Fatal("expected transparent pixel:", c.At(0, 0))
+	}
+	if colorKey(c.At(1, 1)) != colorKey(color.RGBA{G: 0xff, A: 0xff}) {
+		t.Fatal("unexpected pixel:", c.At(1, 1))
+	}
+}
+
+func TestReadChunkOversized(t *testing.T) {
+	// a chunk claiming the largest valid length, followed by only a few bytes
+	data := []byte("\x7f\xff\xff\xffIDAT\x00\x01\x02\x03")
+	s0, s1 := new(runtime.MemStats), new(runtime.MemStats)
+	runtime.ReadMemStats(s0)
+	_, _, err := readChunk(bytes.NewReader(data))
+	runtime.ReadMemStats(s1)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("unexpected error:", err)
+	}
+	if n := s1.TotalAlloc - s0.TotalAlloc; n > 1<<20 {
+		t.Fatalf("readChunk allocated %dMB", n>>20)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// toAPNG converts a GIF to an animated PNG.
+func toAPNG(args []string) error {
+	fs := flag.NewFlagSet("to-apng", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return gif.GIFToAPNG(out, gif.NewDecoder(in))
+}
+
+// fromAPNG converts an animated PNG to a GIF.
+func fromAPNG(args []string) error {
+	fs := flag.NewFlagSet("from-apng", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	colors := fs.Int("colors", 256, "maximum number of palette entries")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return gif.APNGToGIF(gif.NewEncoder(out), in, *colors)
+}
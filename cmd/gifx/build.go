@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// build encodes a sequence of PNG images as an animation, loading one image at a time.
+// Images are quantized with stable palettes and all must be the same size as the first.
+func build(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	delay := fs.Duration("delay", 100*time.Millisecond, "delay between frames")
+	loop := fs.Int("loop", 0, "loop count, 0 to loop forever or -1 to play once")
+	colors := fs.Int("colors", 256, "maximum number of palette entries")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("no input images")
+	}
+
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	names := fs.Args()
+	var size image.Point
+	src := gif.ImageFunc(func(context.Context) (image.Image, error) {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+		name := names[0]
+		names = names[1:]
+		m, err := readPNG(name)
+		if err != nil {
+			return nil, err
+		}
+		if size == (image.Point{}) {
+			size = m.Bounds().Size()
+		} else if m.Bounds().Size() != size {
+			return nil, errors.New(name + ": image size differs from the first image")
+		}
+		return m, nil
+	}, *delay)
+
+	p := gif.NewPipeline(gif.NewEncoder(out), src, &gif.PipelineOptions{
+		LoopCount: *loop,
+		NumColors: *colors,
+		Optimize:  true,
+	})
+	return p.Run(context.Background())
+}
+
+func readPNG(name string) (image.Image, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return png.Decode(in)
+}
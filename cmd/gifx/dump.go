@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"path/filepath"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// dump describes every block as text or JSON.
+func dump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	js := fs.Bool("json", false, "write JSON that assemble can read")
+	dir := fs.String("png", "", "directory to write frame pixels to as PNG files, rather than inline hex")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	opts := &gif.DumpOptions{JSON: *js}
+	if *dir != "" {
+		opts.Image = func(i int, pm *image.Paletted) (string, error) {
+			ref := fmt.Sprintf("frame%04d.png", i)
+			return ref, writePNG(filepath.Join(*dir, ref), &gif.Frame{Image: pm})
+		}
+	}
+	return gif.Dump(out, gif.NewDecoder(in), opts)
+}
+
+// assemble writes the GIF described by JSON from dump.
+func assemble(args []string) error {
+	fs := flag.NewFlagSet("assemble", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	dir := fs.String("png", ".", "directory that referenced PNG files are relative to")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	opts := &gif.AssembleOptions{
+		Image: func(ref string) (image.Image, error) {
+			if !filepath.IsAbs(ref) {
+				ref = filepath.Join(*dir, ref)
+			}
+			return readPNG(ref)
+		},
+	}
+	return gif.Assemble(gif.NewEncoder(out), in, opts)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// edit changes the loop count, frame delays and comments, copying everything else unchanged.
+func edit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	loop := fs.Int("loop", 0, "loop count, 0 to loop forever or -1 to play once")
+	delay := fs.Duration("delay", 0, "delay applied to every frame")
+	var comments []string
+	fs.Func("comment", "comment to add, may be repeated", func(s string) error {
+		comments = append(comments, s)
+		return nil
+	})
+	strip := fs.Bool("strip-comments", false, "remove existing comments")
+	_ = fs.Parse(args)
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	dec := gif.NewDecoder(in)
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+	hdr.Version = ""
+	enc := gif.NewEncoder(out)
+	if err := enc.WriteHeaderFrom(hdr); err != nil {
+		return err
+	}
+	if set["loop"] && *loop >= 0 {
+		if err := enc.WriteApplicationNetscape(&gif.ApplicationNetscape{LoopCount: *loop}); err != nil {
+			return err
+		}
+	}
+	for _, c := range comments {
+		if err := enc.WriteComment(&gif.Comment{Strings: splitComment(c)}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch blk := blk.(type) {
+		case *gif.Frame:
+			if set["delay"] {
+				blk.DelayTime = *delay
+			}
+		case *gif.PlainText:
+			if set["delay"] {
+				blk.DelayTime = *delay
+			}
+		case *gif.ApplicationNetscape:
+			if set["loop"] {
+				continue
+			}
+		case *gif.Comment:
+			if *strip {
+				continue
+			}
+		}
+		if err := writeBlock(enc, blk); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.WriteTrailer(); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// splitComment splits the given text into strings of at most 255 bytes, and replaces any
+// characters that comments can't hold.
+func splitComment(s string) []string {
+	s = strings.Map(func(r rune) rune {
+		if r > 0x7f {
+			return '?'
+		}
+		return r
+	}, s)
+	var strs []string
+	for len(s) > 255 {
+		strs = append(strs, s[:255])
+		s = s[255:]
+	}
+	return append(strs, s)
+}
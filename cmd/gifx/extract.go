@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// extract writes each frame to a numbered PNG file.
+func extract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	dir := fs.String("dir", ".", "output directory")
+	prefix := fs.String("prefix", "frame", "output file name prefix")
+	raw := fs.Bool("raw", false, "write frames as stored rather than as displayed")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dec := gif.NewDecoder(in)
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+	c := gif.NewCoalescer(hdr.Config)
+	for i := 0; ; {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		f, ok := blk.(*gif.Frame)
+		if !ok {
+			continue
+		}
+		if !*raw {
+			f = c.Coalesce(f)
+		}
+		if err := writePNG(filepath.Join(*dir, fmt.Sprintf("%s%04d.png", *prefix, i)), f); err != nil {
+			return err
+		}
+		i++
+	}
+}
+
+func writePNG(name string, f *gif.Frame) error {
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, f.Image); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// info prints the header followed by a line for every block.
+func info(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput("")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	dec := gif.NewDecoder(in)
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "version: %s\n", hdr.Version)
+	fmt.Fprintf(out, "screen: %dx%d\n", hdr.Config.Width, hdr.Config.Height)
+	if gp, ok := hdr.Config.ColorModel.(color.Palette); ok && len(gp) > 0 {
+		fmt.Fprintf(out, "global palette: %d colors, background %d\n", len(gp), hdr.BackgroundIndex)
+	}
+	if hdr.AspectRatio != 0 {
+		fmt.Fprintf(out, "pixel aspect ratio: %.3f\n", hdr.PixelAspectRatio())
+	}
+
+	frames := 0
+	var total time.Duration
+	for {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch blk := blk.(type) {
+		case *gif.Frame:
+			pm := blk.Image
+			fmt.Fprintf(out, "frame %d: %dx%d at %d,%d, delay %v, disposal %s", frames,
+				pm.Rect.Dx(), pm.Rect.Dy(), pm.Rect.Min.X, pm.Rect.Min.Y, blk.DelayTime, disposalName(blk.DisposalMethod))
+			if !hdr.IsGlobalTable(pm.Palette) {
+				fmt.Fprintf(out, ", local palette: %d colors", len(pm.Palette))
+			}
+			for i, c := range pm.Palette {
+				if _, _, _, a := c.RGBA(); a == 0 {
+					fmt.Fprintf(out, ", transparent %d", i)
+					break
+				}
+			}
+			fmt.Fprintln(out)
+			frames++
+			total += blk.DelayTime
+		case *gif.PlainText:
+			fmt.Fprintf(out, "plain text: %dx%d at %d,%d, cell %dx%d, %q\n", blk.TextGridWidth, blk.TextGridHeight,
+				blk.TextGridLeftPosition, blk.TextGridTopPosition, blk.CharacterCellWidth, blk.CharacterCellHeight, blk.Strings)
+		case *gif.Comment:
+			fmt.Fprintf(out, "comment: %q\n", blk.Strings)
+		case *gif.ApplicationNetscape:
+			if blk.LoopCount == 0 {
+				fmt.Fprintln(out, "loop count: forever")
+			} else {
+				fmt.Fprintf(out, "loop count: %d\n", blk.LoopCount)
+			}
+		case *gif.UnknownApplication:
+			fmt.Fprintf(out, "application: %s, %d sub-blocks\n", blk.Identifier, len(blk.SubBlocks))
+		case *gif.UnknownExtension:
+			fmt.Fprintf(out, "extension: 0x%.2x, %d sub-blocks\n", blk.Label, len(blk.SubBlocks))
+		}
+	}
+	fmt.Fprintf(out, "total: %d frames, %v\n", frames, total)
+	if frames == 0 {
+		fmt.Fprintln(os.Stderr, "gifx: warning: no frames")
+	}
+	return nil
+}
+
+func disposalName(d byte) string {
+	switch d {
+	case 0:
+		return "unspecified"
+	case gif.DisposalNone:
+		return "none"
+	case gif.DisposalBackground:
+		return "background"
+	case gif.DisposalPrevious:
+		return "previous"
+	}
+	return fmt.Sprintf("reserved(%d)", d)
+}
@@ -0,0 +1,134 @@
+// Command gifx inspects and edits GIF files. Most subcommands stream blocks one at a time,
+// so memory use is bounded by the largest frame rather than the size of the file. The
+// exceptions are sheet and unsheet, which hold every frame, to-apng, which holds compressed
+// frames until the end of the file, and play, which holds standard input in memory so that it
+// can loop.
+//
+// Usage:
+//
+//	gifx info [file]
+//	gifx extract [-dir dir] [-prefix name] [-raw] [file]
+//	gifx build [-o file] [-delay d] [-loop n] [-colors n] image.png...
+//	gifx optimize [-o file] [file]
+//	gifx edit [-o file] [-loop n] [-delay d] [-comment text] [-strip-comments] [file]
+//	gifx dump [-o file] [-json] [-png dir] [file]
+//	gifx assemble [-o file] [-png dir] [file]
+//	gifx validate [file]
+//	gifx to-apng [-o file] [file]
+//	gifx from-apng [-o file] [-colors n] [file]
+//	gifx sheet -o sheet.png [-manifest file] [-packed] [-columns n] [-padding n] [file]
+//	gifx unsheet -manifest file [-o file] [sheet.png]
+//	gifx play [-mode halfblock|sixel|kitty] [-diff=false] [file]
+//
+// A file argument of "-" or no file argument at all reads from standard input, and output
+// is written to standard output unless -o is given.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+var commands = map[string]func(args []string) error{
+	"info":      info,
+	"extract":   extract,
+	"build":     build,
+	"optimize":  optimize,
+	"edit":      edit,
+	"dump":      dump,
+	"assemble":  assemble,
+	"validate":  validate,
+	"to-apng":   toAPNG,
+	"from-apng": fromAPNG,
+	"sheet":     sheet,
+	"unsheet":   unsheet,
+	"play":      play,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "gifx:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gifx <info|extract|build|optimize|edit|dump|assemble|validate|to-apng|from-apng|sheet|unsheet|play> [flags] [args]")
+	os.Exit(2)
+}
+
+// openInput returns the named file, or standard input if the name is empty or "-".
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// inputName returns the single optional file argument.
+func inputName(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	}
+	return "", fmt.Errorf("unexpected arguments: %v", args[1:])
+}
+
+// output is a buffered destination file, or standard output if the name is empty or "-".
+type output struct {
+	*bufio.Writer
+	f *os.File
+}
+
+func createOutput(name string) (*output, error) {
+	f := os.Stdout
+	if name != "" && name != "-" {
+		var err error
+		if f, err = os.Create(name); err != nil {
+			return nil, err
+		}
+	}
+	return &output{bufio.NewWriter(f), f}, nil
+}
+
+func (o *output) Close() error {
+	err := o.Flush()
+	if o.f != os.Stdout {
+		if cerr := o.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// writeBlock writes any block returned by Decoder.ReadBlock.
+func writeBlock(enc *gif.Encoder, blk any) error {
+	switch blk := blk.(type) {
+	case *gif.Frame:
+		return enc.WriteFrame(blk)
+	case *gif.PlainText:
+		return enc.WritePlainText(blk)
+	case *gif.Comment:
+		return enc.WriteComment(blk)
+	case *gif.ApplicationNetscape:
+		return enc.WriteApplicationNetscape(blk)
+	case *gif.UnknownApplication:
+		return enc.WriteUnknownApplication(blk)
+	case *gif.UnknownExtension:
+		return enc.WriteUnknownExtension(blk)
+	}
+	return nil
+}
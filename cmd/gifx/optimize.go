@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// optimize re-encodes a GIF so that each frame only stores the pixels that changed.
+func optimize(args []string) error {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return gif.OptimizeStream(gif.NewEncoder(out), gif.NewDecoder(in))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/NathanBaulch/gifx/term"
+)
+
+// play plays an animation in the terminal until it ends or is interrupted.
+func play(args []string) error {
+	fs := flag.NewFlagSet("play", flag.ExitOnError)
+	mode := fs.String("mode", "halfblock", "drawing mode, one of halfblock, sixel or kitty")
+	diff := fs.Bool("diff", true, "only redraw what changed between frames")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	opts := &term.Options{Diff: *diff}
+	switch *mode {
+	case "halfblock":
+		opts.Mode = term.HalfBlock
+	case "sixel":
+		opts.Mode = term.Sixel
+	case "kitty":
+		opts.Mode = term.Kitty
+	default:
+		return fmt.Errorf("unknown mode %q", *mode)
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if _, ok := in.(io.Seeker); !ok {
+		// looping reads the input again, so keep the encoded GIF in memory
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := term.PlayStream(ctx, os.Stdout, r, opts); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
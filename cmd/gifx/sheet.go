@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"image/png"
+	"os"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// sheet writes the frames of a GIF to a PNG sprite sheet and a JSON manifest.
+func sheet(args []string) error {
+	fs := flag.NewFlagSet("sheet", flag.ExitOnError)
+	o := fs.String("o", "", "output PNG file")
+	manifest := fs.String("manifest", "", "output JSON manifest file, or standard output if empty")
+	packed := fs.Bool("packed", false, "trim frames and pack them into a tight atlas")
+	columns := fs.Int("columns", 0, "number of grid columns, or 0 for a square grid")
+	padding := fs.Int("padding", 0, "transparent pixels between frames")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *o == "" || *o == "-" {
+		return errors.New("an output PNG file is required")
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	g, err := gif.DecodeAll(in)
+	if err != nil {
+		return err
+	}
+	pm, sm, err := gif.SpriteSheet(g, &gif.SheetOptions{Packed: *packed, Columns: *columns, Padding: *padding})
+	if err != nil {
+		return err
+	}
+
+	img, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(img, pm); err != nil {
+		img.Close()
+		return err
+	}
+	if err := img.Close(); err != nil {
+		return err
+	}
+
+	out, err := createOutput(*manifest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	return e.Encode(sm)
+}
+
+// unsheet builds a GIF from a PNG sprite sheet and a JSON manifest.
+func unsheet(args []string) error {
+	fs := flag.NewFlagSet("unsheet", flag.ExitOnError)
+	o := fs.String("o", "", "output file")
+	manifest := fs.String("manifest", "", "JSON manifest file")
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *manifest == "" {
+		return errors.New("a manifest file is required")
+	}
+
+	data, err := os.ReadFile(*manifest)
+	if err != nil {
+		return err
+	}
+	sm := &gif.SheetManifest{}
+	if err := json.Unmarshal(data, sm); err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	m, err := png.Decode(in)
+	if err != nil {
+		return err
+	}
+
+	g, err := gif.FromSpriteSheet(m, sm)
+	if err != nil {
+		return err
+	}
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return gif.EncodeAll(out, g)
+}
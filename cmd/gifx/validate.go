@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// validate prints spec violations and compatibility hazards, failing if there are any violations.
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	_ = fs.Parse(args)
+	name, err := inputName(fs.Args())
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput("")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	issues, err := gif.Validate(in)
+	if err != nil {
+		return err
+	}
+	violations := 0
+	for _, i := range issues {
+		fmt.Fprintln(out, i)
+		if i.Severity == gif.Violation {
+			violations++
+		}
+	}
+	if violations > 0 {
+		return fmt.Errorf("%d spec violations", violations)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+)
+
+// Coalesce returns a copy of the given GIF in which every frame is a full logical screen image
+// with no disposal, as it would appear when displayed. See Coalescer.
+func Coalesce(g *GIF) *GIF {
+	c := NewCoalescer(g.Config)
+	out := &GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           make([]int, len(g.Image)),
+		Disposal:        make([]byte, len(g.Image)),
+		LoopCount:       g.LoopCount,
+		Config:          g.Config,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+	copy(out.Delay, g.Delay)
+	frames := make([]*Frame, len(g.Image))
+	for i, pm := range g.Image {
+		f := &Frame{Image: pm}
+		if g.Disposal != nil {
+			f.DisposalMethod = g.Disposal[i]
+		}
+		frames[i] = c.Coalesce(f)
+		out.Image[i] = frames[i].Image
+	}
+	for i, f := range frames {
+		out.Disposal[i] = f.DisposalMethod
+	}
+	return out
+}
+
+// NewCoalescer returns a new Coalescer for the logical screen described by the given config,
+// typically Header.Config.
+func NewCoalescer(cfg image.Config) *Coalescer {
+	c := &Coalescer{
+		rect:   image.Rect(0, 0, cfg.Width, cfg.Height),
+		canvas: make([]uint32, cfg.Width*cfg.Height),
+		colors: map[uint32]color.Color{transparentKey: color.Transparent},
+	}
+	for i := range c.canvas {
+		c.canvas[i] = transparentKey
+	}
+	return c
+}
+
+// Coalescer converts a stream of frames, made up of any mix of sub-images and disposal
+// methods, into full logical screen frames with DisposalNone. Its output can be passed
+// to Optimizer to produce an equivalent optimized animation.
+//
+// Transparent pixels in a full frame cannot hide what the previous frame drew, so when a frame
+// reveals transparency, the previously returned frame is changed to use DisposalBackground.
+// Callers that encode frames as they are returned should therefore delay by one frame.
+type Coalescer struct {
+	rect   image.Rectangle
+	canvas []uint32 // color keys of the composited image
+	prev   []uint32 // canvas to restore for DisposalPrevious
+	last   []uint32 // canvas as it was last returned
+	out    *Frame   // frame last returned
+	colors map[uint32]color.Color
+}
+
+const transparentKey = 1 << 24
+
+// Coalesce draws the given frame onto the internal canvas and returns the result as a new
+// full logical screen frame. The frame's palette is used where it contains every visible color,
+// otherwise a local palette is built that extends it with the missing colors.
+func (c *Coalescer) Coalesce(f *Frame) *Frame {
+	pm := f.Image
+	if f.DisposalMethod == DisposalPrevious {
+		if c.prev == nil {
+			c.prev = make([]uint32, len(c.canvas))
+		}
+		copy(c.prev, c.canvas)
+	}
+
+	keys := make([]uint32, len(pm.Palette))
+	for i, col := range pm.Palette {
+		keys[i] = colorKey(col)
+		if _, ok := c.colors[keys[i]]; !ok {
+			c.colors[keys[i]] = col
+		}
+	}
+	r := pm.Rect.Intersect(c.rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := pm.PixOffset(r.Min.X, y)
+		j := y*c.rect.Dx() + r.Min.X
+		for _, p := range pm.Pix[i : i+r.Dx()] {
+			if int(p) < len(keys) && keys[p] != transparentKey {
+				c.canvas[j] = keys[p]
+			}
+			j++
+		}
+	}
+
+	out := &Frame{
+		Image:          c.render(pm.Palette),
+		DelayTime:      f.DelayTime,
+		DisposalMethod: DisposalNone,
+	}
+	if c.last == nil {
+		c.last = make([]uint32, len(c.canvas))
+	} else {
+		for i, key := range c.canvas {
+			if key == transparentKey && c.last[i] != transparentKey {
+				c.out.DisposalMethod = DisposalBackground
+				break
+			}
+		}
+	}
+	copy(c.last, c.canvas)
+	c.out = out
+
+	switch f.DisposalMethod {
+	case DisposalBackground:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			j := y*c.rect.Dx() + r.Min.X
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c.canvas[j] = transparentKey
+				j++
+			}
+		}
+	case DisposalPrevious:
+		copy(c.canvas, c.prev)
+	}
+	return out
+}
+
+// render returns the canvas as a paletted image, using the given palette where possible.
+// Transparent areas always get a transparent entry, see withTransparent for full palettes.
+func (c *Coalescer) render(p color.Palette) *image.Paletted {
+	if len(p) == 256 && findTransparent(p) < 0 {
+		for _, key := range c.canvas {
+			if key == transparentKey {
+				p, _ = withTransparent(p)
+				break
+			}
+		}
+	}
+	indexes := paletteKeys(p)
+	extended := false
+	dst := image.NewPaletted(c.rect, p)
+	for i, key := range c.canvas {
+		idx, ok := indexes[key]
+		if !ok {
+			if len(dst.Palette) < 256 {
+				if !extended {
+					dst.Palette = append(color.Palette(nil), p...)
+					extended = true
+				}
+				idx = uint8(len(dst.Palette))
+				dst.Palette = append(dst.Palette, c.colors[key])
+			} else {
+				idx = uint8(dst.Palette.Index(c.colors[key]))
+			}
+			indexes[key] = idx
+		}
+		dst.Pix[i] = idx
+	}
+	return dst
+}
@@ -0,0 +1,100 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCoalesce(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	gp := color.Palette{black, white, color.Transparent}
+	lp := color.Palette{red, color.Transparent}
+	newFrame := func(r image.Rectangle, p color.Palette, pix ...uint8) *image.Paletted {
+		pm := image.NewPaletted(r, p)
+		copy(pm.Pix, pix)
+		return pm
+	}
+	g := &GIF{
+		Image: []*image.Paletted{
+			newFrame(image.Rect(0, 0, 2, 2), gp, 0, 0, 0, 0),
+			newFrame(image.Rect(1, 1, 2, 2), gp, 1),
+			newFrame(image.Rect(0, 0, 2, 1), lp, 0, 1),
+			newFrame(image.Rect(0, 1, 1, 2), gp, 1),
+		},
+		Delay:    []int{1, 2, 3, 4},
+		Disposal: []byte{DisposalNone, DisposalBackground, DisposalPrevious, 0},
+		Config:   image.Config{Width: 2, Height: 2, ColorModel: gp},
+	}
+	wants := [][]color.Color{
+		{black, black, black, black},
+		{black, black, black, white},
+		{red, black, black, color.Transparent},
+		{black, black, white, color.Transparent},
+	}
+
+	check := func(c *GIF) {
+		t.Helper()
+		for i, pm := range c.Image {
+			if pm.Rect != image.Rect(0, 0, 2, 2) {
+				t.Fatal("frame", i, "unexpected bounds:", pm.Rect)
+			}
+			want := byte(DisposalNone)
+			if i == 1 {
+				want = DisposalBackground // precedes a frame that reveals transparency
+			}
+			if c.Disposal[i] != want {
+				t.Fatal("frame", i, "unexpected disposal:", c.Disposal[i], "want:", want)
+			}
+			for j, want := range wants[i] {
+				if got := pm.At(j%2, j/2); colorKey(got) != colorKey(want) {
+					t.Fatal("frame", i, "unexpected pixel", j, "got:", got, "want:", want)
+				}
+			}
+		}
+	}
+
+	c := Coalesce(g)
+	check(c)
+	if &c.Image[0].Palette[0] != &gp[0] {
+		t.Fatal("global palette not reused")
+	}
+	if len(c.Image[2].Palette) != 3 {
+		t.Fatal("unexpected extended palette:", c.Image[2].Palette)
+	}
+	if c.Delay[3] != 4 {
+		t.Fatal("unexpected delay:", c.Delay[3])
+	}
+
+	// round trip through the encoder
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, c); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	if d, err := DecodeAll(buf); err != nil {
+		t.Fatal("DecodeAll:", err)
+	} else {
+		check(Coalesce(d))
+	}
+}
+
+func TestCoalesceFullPalette(t *testing.T) {
+	gp := make(color.Palette, 256)
+	for i := range gp {
+		gp[i] = color.Gray{Y: uint8(i)}
+	}
+	c := NewCoalescer(image.Config{Width: 2, Height: 1})
+	pm := image.NewPaletted(image.Rect(1, 0, 2, 1), gp)
+	pm.Pix[0] = 200
+	out := c.Coalesce(&Frame{Image: pm}).Image
+	if _, _, _, a := out.At(0, 0).RGBA(); a != 0 {
+		t.Fatal("uncovered pixel painted opaque:", out.At(0, 0))
+	}
+	if got := out.At(1, 0); colorKey(got) != colorKey(gp[200]) {
+		t.Fatal("unexpected pixel:", got)
+	}
+	if gp[1] != (color.Gray{Y: 1}) {
+		t.Fatal("source palette modified")
+	}
+}
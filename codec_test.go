@@ -6,6 +6,7 @@ import (
 	"image/color"
 	stdgif "image/gif"
 	"io"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -175,3 +176,432 @@ func doDecode(t *testing.T, fn func(*Decoder), data []byte) {
 		t.Fatal("unexpected block: got:", blk, "want: EOF")
 	}
 }
+
+func TestVersion(t *testing.T) {
+	pal := color.Palette{black, white}
+	for _, tc := range []struct {
+		vers string
+		fn   func(*Encoder) error
+		want string
+	}{
+		{"", nil, "GIF87a"},
+		{"", func(enc *Encoder) error { return enc.WriteComment(&Comment{Strings: []string{"hello"}}) }, "GIF89a"},
+		{"", func(enc *Encoder) error {
+			return enc.WriteFrame(&Frame{Image: image.NewPaletted(image.Rect(0, 0, 1, 1), pal), DelayTime: time.Second})
+		}, "GIF89a"},
+		{"GIF89a", nil, "GIF89a"},
+		{"GIF87a", nil, "GIF87a"},
+	} {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		if err := enc.WriteHeaderFrom(&Header{Version: tc.vers, Config: image.Config{Width: 1, Height: 1}}); err != nil {
+			t.Fatal("WriteHeaderFrom:", err)
+		}
+		if tc.fn != nil {
+			if err := tc.fn(enc); err != nil {
+				t.Fatal("write:", err)
+			}
+		} else if err := enc.Flush(); err != nil {
+			t.Fatal("Flush:", err)
+		} else if tc.vers == "" && buf.Len() > 0 {
+			t.Fatal("unexpected output before version resolved:", buf.Len())
+		}
+		if err := enc.WriteFrame(&Frame{Image: image.NewPaletted(image.Rect(0, 0, 1, 1), pal)}); err != nil {
+			t.Fatal("WriteFrame:", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatal("Flush:", err)
+		}
+		if err := enc.WriteTrailer(); err != nil {
+			t.Fatal("WriteTrailer:", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatal("Flush:", err)
+		}
+
+		dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if hdr, err := dec.ReadHeader(); err != nil {
+			t.Fatal("ReadHeader:", err)
+		} else if hdr.Version != tc.want {
+			t.Fatal("unexpected version: got:", hdr.Version, "want:", tc.want)
+		}
+		if _, err := stdgif.DecodeAll(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal("standard lib DecodeAll:", err)
+		}
+	}
+}
+
+func TestVersion87a(t *testing.T) {
+	pal := color.Palette{black, white}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderFrom(&Header{Version: "GIF87a", Config: image.Config{Width: 1, Height: 1}}); err != nil {
+		t.Fatal("WriteHeaderFrom:", err)
+	}
+	for i, fn := range []func() error{
+		func() error { return enc.WriteComment(&Comment{Strings: []string{"hello"}}) },
+		func() error { return enc.WriteApplicationNetscape(&ApplicationNetscape{}) },
+		func() error { return enc.WriteUnknownApplication(&UnknownApplication{Identifier: "ABCDEFGH123"}) },
+		func() error { return enc.WriteUnknownExtension(&UnknownExtension{Label: 0x42}) },
+		func() error { return enc.WritePlainText(&PlainText{Strings: []string{"hi"}}) },
+		func() error {
+			return enc.WriteFrame(&Frame{Image: image.NewPaletted(image.Rect(0, 0, 1, 1), pal), DelayTime: time.Second})
+		},
+	} {
+		if err := fn(); err == nil {
+			t.Fatal("block", i, "written to GIF87a stream")
+		}
+	}
+	if err := enc.WriteFrame(&Frame{Image: image.NewPaletted(image.Rect(0, 0, 1, 1), pal)}); err != nil {
+		t.Fatal("WriteFrame:", err)
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	g, err := stdgif.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("standard lib DecodeAll:", err)
+	}
+	if len(g.Image) != 1 || string(buf.Bytes()[:6]) != "GIF87a" {
+		t.Fatal("unexpected output:", len(g.Image), string(buf.Bytes()[:6]))
+	}
+}
+
+func TestVersionHeaderOnly(t *testing.T) {
+	// only the header is held back, so a large first frame reaches the output before the trailer
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderFrom(&Header{Config: image.Config{Width: 64, Height: 64}}); err != nil {
+		t.Fatal("WriteHeaderFrom:", err)
+	}
+	f := noisyFrame(64)
+	if err := enc.WriteFrame(f); err != nil {
+		t.Fatal("WriteFrame:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+	if buf.Len() < len(f.Image.Pix)/2 {
+		t.Fatal("output held back:", buf.Len())
+	}
+	if string(buf.Bytes()[:6]) != "GIF87a" {
+		t.Fatal("unexpected version:", string(buf.Bytes()[:6]))
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{black, white})
+	for _, tc := range []struct {
+		g    *GIF
+		want string
+	}{
+		{&GIF{Image: []*image.Paletted{pm}, Delay: []int{0}}, "GIF87a"},
+		{&GIF{Image: []*image.Paletted{pm, pm}, Delay: []int{0, 0}, LoopCount: -1}, "GIF87a"},
+		{&GIF{Image: []*image.Paletted{pm, pm}, Delay: []int{0, 0}}, "GIF89a"},
+		{&GIF{Image: []*image.Paletted{pm}, Delay: []int{1}}, "GIF89a"},
+	} {
+		buf := &bytes.Buffer{}
+		if err := NewEncoder(buf).Encode(tc.g); err != nil {
+			t.Fatal("Encode:", err)
+		}
+		if got := string(buf.Bytes()[:6]); got != tc.want {
+			t.Fatal("unexpected version: got:", got, "want:", tc.want)
+		}
+	}
+}
+
+func TestDisposalInherited(t *testing.T) {
+	// the second frame has no graphic control extension, so keeps the previous disposal method
+	// as in image/gif, whichever way it is decoded
+	p := color.Palette{black, white}
+	g := &GIF{
+		Image:    []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 1, 1), p), image.NewPaletted(image.Rect(0, 0, 1, 1), p)},
+		Delay:    []int{0, 0},
+		Disposal: []byte{DisposalBackground, 0},
+	}
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	data := buf.Bytes()
+	want := []byte{DisposalBackground, DisposalBackground}
+
+	if got, err := DecodeAll(bytes.NewReader(data)); err != nil {
+		t.Fatal("DecodeAll:", err)
+	} else if !reflect.DeepEqual(got.Disposal, want) {
+		t.Fatal("DecodeAll: unexpected disposal: got:", got.Disposal, "want:", want)
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	if _, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	for i := 0; i < len(want); {
+		if blk, err := dec.ReadBlock(); err != nil {
+			t.Fatal("ReadBlock:", err)
+		} else if f, ok := blk.(*Frame); ok {
+			if f.DisposalMethod != want[i] {
+				t.Fatal("ReadBlock: frame", i, "unexpected disposal: got:", f.DisposalMethod, "want:", want[i])
+			}
+			i++
+		}
+	}
+	dec = NewDecoder(bytes.NewReader(data))
+	if _, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	for i := range want {
+		if f, err := dec.ReadFrameInto(&image.Paletted{}); err != nil {
+			t.Fatal("ReadFrameInto:", err)
+		} else if f.DisposalMethod != want[i] {
+			t.Fatal("ReadFrameInto: frame", i, "unexpected disposal: got:", f.DisposalMethod, "want:", want[i])
+		}
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	hdr := &Header{Version: "GIF89a", Config: image.Config{Width: 10, Height: 10, ColorModel: color.Palette{black, white}}}
+	hdr.SetPixelAspectRatio(2)
+	if hdr.AspectRatio != 113 {
+		t.Fatal("unexpected aspect ratio: got:", hdr.AspectRatio, "want:", 113)
+	}
+	if got, want := hdr.DisplaySize(), image.Pt(20, 10); got != want {
+		t.Fatal("unexpected display size: got:", got, "want:", want)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderFrom(hdr); err != nil {
+		t.Fatal("WriteHeaderFrom:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if got, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	} else if !reflect.DeepEqual(got, hdr) {
+		t.Fatal("unexpected header: got:", got, "want:", hdr)
+	} else if r := got.PixelAspectRatio(); r != 2 {
+		t.Fatal("unexpected pixel aspect ratio: got:", r, "want:", 2)
+	}
+}
+
+func TestIsGlobalTable(t *testing.T) {
+	hdr := &Header{Config: image.Config{ColorModel: color.Palette{black, white}}}
+	// the decoder substitutes the transparent entry into a copy of the global color table
+	if !hdr.IsGlobalTable(color.Palette{black, color.RGBA{}}) {
+		t.Fatal("global color table with transparent entry not recognized")
+	}
+	if hdr.IsGlobalTable(color.Palette{white, black}) || hdr.IsGlobalTable(color.Palette{black}) {
+		t.Fatal("local color table reported as global")
+	}
+	if (&Header{}).IsGlobalTable(nil) {
+		t.Fatal("missing global color table reported as used")
+	}
+}
+
+func TestWriteImageFrame(t *testing.T) {
+	gp := color.Palette{black, white}
+	m := image.NewRGBA(image.Rect(1, 1, 3, 2))
+	m.Set(1, 1, color.White)
+	m.Set(2, 1, color.Black)
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeader(image.Config{Width: 4, Height: 4, ColorModel: gp}, 0); err != nil {
+		t.Fatal("WriteHeader:", err)
+	}
+	if err := enc.WriteImageFrame(m, 50*time.Millisecond, WithGlobalPalette()); err != nil {
+		t.Fatal("WriteImageFrame:", err)
+	}
+	m.Set(1, 1, color.RGBA{R: 0xff, A: 0xff})
+	if err := enc.WriteImageFrame(m, 50*time.Millisecond, WithGlobalPalette(), WithNumColors(4)); err != nil {
+		t.Fatal("WriteImageFrame:", err)
+	}
+	// paletted images are remapped by palette entry rather than by pixel
+	pm := image.NewPaletted(m.Rect, color.Palette{white, black})
+	pm.Pix[1] = 1
+	if err := enc.WriteImageFrame(pm, 50*time.Millisecond, WithGlobalPalette()); err != nil {
+		t.Fatal("WriteImageFrame:", err)
+	}
+	if n := testing.AllocsPerRun(10, func() {
+		if enc.toGlobalPaletted(pm) == nil {
+			t.Fatal("paletted image not mapped onto global palette")
+		}
+	}); n > 0 {
+		t.Fatal("unexpected allocations:", n)
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	g, err := DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if len(g.Image) != 3 {
+		t.Fatal("unexpected frame count: got:", len(g.Image), "want:", 3)
+	}
+	if pm := g.Image[0]; pm.Rect != m.Rect || !palettesEqual(pm.Palette, gp) || pm.Pix[0] != 1 || pm.Pix[1] != 0 {
+		t.Fatal("unexpected first frame:", pm.Rect, pm.Palette, pm.Pix)
+	}
+	if pm := g.Image[1]; len(pm.Palette) != 4 || palettesEqual(pm.Palette, gp) {
+		t.Fatal("unexpected second frame:", pm.Palette, pm.Pix)
+	}
+	if pm := g.Image[2]; &pm.Palette[0] != &g.Config.ColorModel.(color.Palette)[0] || pm.Pix[0] != 1 || pm.Pix[1] != 0 {
+		t.Fatal("unexpected third frame:", pm.Palette, pm.Pix)
+	}
+	if g.Delay[0] != 5 || g.Delay[1] != 5 {
+		t.Fatal("unexpected delays:", g.Delay)
+	}
+}
+
+func TestReadFrameInto(t *testing.T) {
+	// an animation with a transparent index and a local color table, plus the test images
+	g := &GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 3, 2), color.Palette{black, white, color.RGBA{}}),
+			image.NewPaletted(image.Rect(1, 1, 2, 2), color.Palette{white, black}),
+		},
+		Delay:     []int{5, 7},
+		Disposal:  []byte{DisposalNone, DisposalBackground},
+		LoopCount: 2,
+	}
+	g.Image[0].Pix = []uint8{0, 1, 2, 1, 0, 2}
+	g.Image[1].Pix[0] = 1
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	inputs := map[string][]byte{"animation": buf.Bytes()}
+	for _, name := range []string{"testdata/video-001.gif", "testdata/video-001.interlaced.gif", "testdata/video-005.gray.gif"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal("ReadFile:", err)
+		}
+		inputs[name] = data
+	}
+
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			want, err := DecodeAll(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			dec := NewDecoder(bytes.NewReader(data))
+			if _, err := dec.ReadHeader(); err != nil {
+				t.Fatal("ReadHeader:", err)
+			}
+			dst := &image.Paletted{}
+			for i := 0; ; i++ {
+				f, err := dec.ReadFrameInto(dst)
+				if err == io.EOF {
+					if i != len(want.Image) {
+						t.Fatal("unexpected frame count:", i)
+					}
+					break
+				} else if err != nil {
+					t.Fatal("ReadFrameInto:", err)
+				}
+				if f.Image != dst || !reflect.DeepEqual(f.Image, want.Image[i]) {
+					t.Fatalf("frame %d: got %v, want %v", i, f.Image, want.Image[i])
+				}
+				if f.DelayTime != time.Duration(want.Delay[i])*10*time.Millisecond || f.DisposalMethod != want.Disposal[i] {
+					t.Fatalf("frame %d: unexpected delay %v or disposal %d", i, f.DelayTime, f.DisposalMethod)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFrameIntoAllocs(t *testing.T) {
+	// frames alternating between the global color table and a local one with transparency
+	gp := color.Palette{black, white}
+	g := &GIF{Config: image.Config{Width: 16, Height: 16, ColorModel: gp}}
+	for i := 0; i < 20; i++ {
+		p := gp
+		if i%2 == 1 {
+			p = color.Palette{black, white, color.RGBA{}}
+		}
+		pm := image.NewPaletted(image.Rect(0, 0, 16-i%3, 16), p)
+		pm.Pix[i] = 1
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, i)
+	}
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+
+	dec := NewDecoder(buf)
+	if _, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	dst := &image.Paletted{}
+	if n := testing.AllocsPerRun(10, func() {
+		if _, err := dec.ReadFrameInto(dst); err != nil {
+			t.Fatal("ReadFrameInto:", err)
+		}
+	}); n > 0 {
+		t.Fatal("unexpected allocations:", n)
+	}
+}
+
+func TestReadFrameIntoSharedPalette(t *testing.T) {
+	// a full global color table, which ReadBlock shares with its frames, then a local one
+	gp := make(color.Palette, 256)
+	for i := range gp {
+		gp[i] = color.RGBA{uint8(i), uint8(i), uint8(i), 0xff}
+	}
+	g := &GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 2, 2), gp),
+			image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{white, black}),
+			image.NewPaletted(image.Rect(0, 0, 2, 2), gp),
+		},
+		Delay:  []int{0, 0, 0},
+		Config: image.Config{Width: 2, Height: 2, ColorModel: gp},
+	}
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+
+	dec := NewDecoder(buf)
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	var f *Frame
+	for f == nil {
+		blk, err := dec.ReadBlock()
+		if err != nil {
+			t.Fatal("ReadBlock:", err)
+		}
+		f, _ = blk.(*Frame)
+	}
+	f2, err := dec.ReadFrameInto(f.Image)
+	if err != nil {
+		t.Fatal("ReadFrameInto:", err)
+	}
+	if len(f2.Image.Palette) != 2 || f2.Image.Palette[0] != white {
+		t.Fatal("unexpected local table:", f2.Image.Palette)
+	}
+	if p := hdr.Config.ColorModel.(color.Palette); !palettesEqual(p, gp) {
+		t.Fatal("global color table overwritten:", p[:2])
+	}
+	f3, err := dec.ReadFrameInto(&image.Paletted{})
+	if err != nil {
+		t.Fatal("ReadFrameInto:", err)
+	}
+	if !palettesEqual(f3.Image.Palette, gp) {
+		t.Fatal("global color table overwritten:", f3.Image.Palette[:2])
+	}
+}
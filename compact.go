@@ -0,0 +1,131 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// CompactPalette removes unused and duplicate entries from the palette of the given image and
+// orders the remaining entries by descending frequency, remapping pixels accordingly. Since
+// both the color table size and the LZW minimum code size are derived from the palette length,
+// the encoded image is typically smaller. The image is modified in place and given a new palette.
+// Pixels with indexes past the end of the palette are mapped to the first entry.
+func CompactPalette(pm *image.Paletted) {
+	compactPalettes([]*image.Paletted{pm}, -1)
+}
+
+// CompactAll compacts the palettes of all images in the given GIF. Images whose palettes have
+// the same colors are compacted together and then share a single palette, including those
+// matching the global color table, whose background index is preserved and remapped.
+func CompactAll(g *GIF) {
+	gp, _ := g.Config.ColorModel.(color.Palette)
+	// the first group holds the images matching the global color table
+	groups := [][]*image.Paletted{nil}
+	palettes := []color.Palette{gp}
+	seen := make(map[*image.Paletted]bool)
+	for _, pm := range g.Image {
+		if seen[pm] || len(pm.Palette) == 0 {
+			continue
+		}
+		seen[pm] = true
+		i := 0
+		for i < len(palettes) && !samePalette(pm.Palette, palettes[i]) {
+			i++
+		}
+		if i == len(palettes) {
+			groups = append(groups, nil)
+			palettes = append(palettes, pm.Palette)
+		}
+		groups[i] = append(groups[i], pm)
+	}
+
+	for _, pms := range groups[1:] {
+		compactPalettes(pms, -1)
+	}
+	if len(gp) > 0 {
+		pms := groups[0]
+		if len(pms) == 0 {
+			// The global color table is unused by any image, but keep the background color.
+			pms = []*image.Paletted{image.NewPaletted(image.Rectangle{}, gp)}
+		}
+		p, remap := compactPalettes(pms, int(g.BackgroundIndex))
+		g.Config.ColorModel = p
+		if int(g.BackgroundIndex) < len(remap) {
+			g.BackgroundIndex = remap[g.BackgroundIndex]
+		}
+	}
+}
+
+// compactPalettes assigns a compacted copy of the palette shared by the given images, keeping the
+// entry at index keep if non-negative. Pixels with indexes past the end of the palette have no
+// color, and are mapped to the first entry. It returns the new palette and the index mapping.
+func compactPalettes(pms []*image.Paletted, keep int) (color.Palette, []uint8) {
+	pal := pms[0].Palette
+	if keep >= len(pal) {
+		keep = -1
+	}
+	var counts [256]int
+	for _, pm := range pms {
+		for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+			i := pm.PixOffset(pm.Rect.Min.X, y)
+			for _, c := range pm.Pix[i : i+pm.Rect.Dx()] {
+				counts[c]++
+			}
+		}
+	}
+
+	// Entries are duplicates when they encode to the same color table bytes,
+	// or when they are both fully transparent.
+	canonical := make([]int, len(pal))
+	keys := make(map[uint32]int, len(pal))
+	totals := make(map[int]int, len(pal))
+	for i, c := range pal {
+		key := colorKey(c)
+		if j, ok := keys[key]; ok {
+			canonical[i] = j
+		} else {
+			keys[key] = i
+			canonical[i] = i
+		}
+		totals[canonical[i]] += counts[i]
+	}
+
+	var order []int
+	for i := range pal {
+		if canonical[i] == i && (totals[i] > 0 || (keep >= 0 && canonical[keep] == i)) {
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		order = append(order, 0)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return totals[order[i]] > totals[order[j]] })
+
+	p := make(color.Palette, len(order))
+	remap := make([]uint8, len(pal))
+	newIndex := make(map[int]uint8, len(order))
+	for i, j := range order {
+		p[i] = pal[j]
+		newIndex[j] = uint8(i)
+	}
+	for i := range pal {
+		remap[i] = newIndex[canonical[i]]
+	}
+
+	for _, pm := range pms {
+		for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+			i := pm.PixOffset(pm.Rect.Min.X, y)
+			row := pm.Pix[i : i+pm.Rect.Dx()]
+			for x, c := range row {
+				if int(c) < len(remap) {
+					row[x] = remap[c]
+				} else {
+					row[x] = 0
+				}
+			}
+		}
+		pm.Palette = p
+	}
+	return p, remap
+}
@@ -0,0 +1,151 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCompactPalette(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	pal := color.Palette{black, white, red, white, color.Transparent, color.RGBA{}}
+	pm := image.NewPaletted(image.Rect(0, 0, 3, 2), pal)
+	copy(pm.Pix, []uint8{1, 3, 1, 5, 4, 1})
+	sub := pm.SubImage(image.Rect(0, 0, 3, 2)).(*image.Paletted)
+
+	CompactPalette(sub)
+	if want := (color.Palette{white, color.Transparent}); !reflect.DeepEqual(sub.Palette, want) {
+		t.Fatal("unexpected palette: got:", sub.Palette, "want:", want)
+	}
+	if want := []uint8{0, 0, 0, 1, 1, 0}; !reflect.DeepEqual(sub.Pix, want) {
+		t.Fatal("unexpected pixels: got:", sub.Pix, "want:", want)
+	}
+
+	var before, after bytes.Buffer
+	pm.Palette = pal
+	copy(pm.Pix, []uint8{1, 3, 1, 5, 4, 1})
+	if err := Encode(&before, pm, nil); err != nil {
+		t.Fatal("Encode:", err)
+	}
+	CompactPalette(pm)
+	if err := Encode(&after, pm, nil); err != nil {
+		t.Fatal("Encode:", err)
+	}
+	if after.Len() >= before.Len() {
+		t.Fatal("compacted image not smaller:", after.Len(), before.Len())
+	}
+}
+
+func TestCompactAll(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	gp := color.Palette{black, white, red, color.Transparent}
+	pm0 := image.NewPaletted(image.Rect(0, 0, 2, 1), gp)
+	pm1 := image.NewPaletted(image.Rect(0, 0, 2, 1), gp)
+	pm2 := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{white, red})
+	copy(pm0.Pix, []uint8{2, 2})
+	copy(pm1.Pix, []uint8{2, 3})
+	copy(pm2.Pix, []uint8{1, 1})
+	g := &GIF{
+		Image:           []*image.Paletted{pm0, pm1, pm2, pm0},
+		Delay:           []int{0, 0, 0, 0},
+		Config:          image.Config{Width: 2, Height: 1, ColorModel: gp},
+		BackgroundIndex: 1,
+	}
+
+	CompactAll(g)
+	if want := (color.Palette{red, color.Transparent, white}); !reflect.DeepEqual(g.Config.ColorModel, want) {
+		t.Fatal("unexpected global palette: got:", g.Config.ColorModel, "want:", want)
+	}
+	if g.BackgroundIndex != 2 {
+		t.Fatal("unexpected background index: got:", g.BackgroundIndex, "want:", 2)
+	}
+	if &pm0.Palette[0] != &pm1.Palette[0] || &pm0.Palette[0] != &g.Config.ColorModel.(color.Palette)[0] {
+		t.Fatal("global palette no longer shared")
+	}
+	if !reflect.DeepEqual(pm0.Pix, []uint8{0, 0}) || !reflect.DeepEqual(pm1.Pix, []uint8{0, 1}) {
+		t.Fatal("unexpected pixels:", pm0.Pix, pm1.Pix)
+	}
+	if want := (color.Palette{red}); !reflect.DeepEqual(pm2.Palette, want) || !reflect.DeepEqual(pm2.Pix, []uint8{0, 0}) {
+		t.Fatal("unexpected local palette:", pm2.Palette, pm2.Pix)
+	}
+}
+
+func TestCompactAllDecoded(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	// equal local palettes are decoded into separate slices
+	var frames []*image.Paletted
+	for i := 0; i < 3; i++ {
+		pm := image.NewPaletted(image.Rect(0, 0, 4, 1), color.Palette{black, white, red, white})
+		copy(pm.Pix, []uint8{0, 2, uint8(i % 2), 2})
+		frames = append(frames, pm)
+	}
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, &GIF{Image: frames, Delay: make([]int, len(frames))}); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"local", buf.Bytes()},
+		{"video-001", nil},
+		{"video-001.interlaced", nil},
+		{"video-005.gray", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := tc.data
+			if data == nil {
+				var err error
+				if data, err = os.ReadFile("testdata/" + tc.name + ".gif"); err != nil {
+					t.Fatal("ReadFile:", err)
+				}
+			}
+			g, err := DecodeAll(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			want := make([][]uint32, len(g.Image))
+			for i, pm := range g.Image {
+				for _, c := range pm.Pix {
+					want[i] = append(want[i], colorKey(pm.Palette[c]))
+				}
+			}
+			before := &bytes.Buffer{}
+			if err := EncodeAll(before, g); err != nil {
+				t.Fatal("EncodeAll:", err)
+			}
+
+			CompactAll(g)
+			after := &bytes.Buffer{}
+			if err := EncodeAll(after, g); err != nil {
+				t.Fatal("EncodeAll:", err)
+			}
+			if after.Len() > before.Len() {
+				t.Fatal("compacted GIF larger:", after.Len(), before.Len())
+			}
+			for i, pm := range g.Image {
+				if &pm.Palette[0] != &g.Image[0].Palette[0] && samePalette(pm.Palette, g.Image[0].Palette) {
+					t.Fatal("frame", i, "doesn't share an equal palette")
+				}
+				for j, c := range pm.Pix {
+					if colorKey(pm.Palette[c]) != want[i][j] {
+						t.Fatal("frame", i, "pixel", j, "changed color")
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompactPaletteOutOfRange(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 3, 1), color.Palette{black, white})
+	copy(pm.Pix, []uint8{1, 7, 1})
+	CompactPalette(pm)
+	if want := []uint8{0, 0, 0}; !reflect.DeepEqual(pm.Pix, want) {
+		t.Fatal("unexpected pixels: got:", pm.Pix, "want:", want)
+	}
+}
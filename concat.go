@@ -0,0 +1,171 @@
+package gif
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Fit controls how each input is placed on the logical screen when concatenating.
+type Fit int
+
+const (
+	FitCenter    Fit = iota // Centered at its original size, cropped if larger than the screen.
+	FitLetterbox            // Scaled to fit within the screen preserving aspect ratio, then centered.
+	FitStretch              // Scaled to fill the screen, ignoring aspect ratio.
+)
+
+// ConcatOptions are the parameters for Concat.
+type ConcatOptions struct {
+	// Width and Height are the logical screen size of the combined animation.
+	// Zero values use the largest width and height of all inputs.
+	Width, Height int
+	Fit           Fit
+	Filter        Filter // Used when inputs are scaled.
+	// LoopCount is the loop count of the combined animation, with the same meaning as
+	// GIF.LoopCount, so the zero value loops forever and -1 plays the result once. The loop
+	// counts of the inputs are ignored and each is played once.
+	LoopCount int
+	// CorrectAspect uses each input's Header.DisplaySize in place of its logical screen size,
+	// so that inputs with non-square pixels keep their proportions on the combined animation,
+	// which always has square pixels.
+	CorrectAspect bool
+}
+
+// Concat plays each decoder's animation in turn and writes the combined animation to the given
+// encoder. Only the headers are read up front, then frames are streamed one at a time, so inputs
+// are never loaded in full. Inputs are coalesced, placed on the common logical screen according
+// to the given options and re-optimized. Areas of the screen not covered by an input are
+// transparent where the palette allows. Plain text extensions are rendered into frames, while
+// comments and unknown extensions are passed through. A nil opts uses the zero ConcatOptions,
+// so the combined animation loops forever regardless of the inputs' loop counts.
+func Concat(enc *Encoder, opts *ConcatOptions, decs ...*Decoder) error {
+	if len(decs) == 0 {
+		return errors.New("gif: must provide at least one decoder")
+	}
+	if opts == nil {
+		opts = &ConcatOptions{}
+	}
+
+	hdrs := make([]*Header, len(decs))
+	sizes := make([]image.Point, len(decs))
+	width, height := opts.Width, opts.Height
+	for i, dec := range decs {
+		hdr, err := dec.ReadHeader()
+		if err != nil {
+			return err
+		}
+		hdrs[i] = hdr
+		sizes[i] = image.Pt(hdr.Config.Width, hdr.Config.Height)
+		if opts.CorrectAspect {
+			sizes[i] = hdr.DisplaySize()
+		}
+		if opts.Width == 0 {
+			width = max(width, sizes[i].X)
+		}
+		if opts.Height == 0 {
+			height = max(height, sizes[i].Y)
+		}
+	}
+	if width < 1 || height < 1 || width > math.MaxUint16 || height > math.MaxUint16 {
+		return errors.New("gif: invalid concat dimensions")
+	}
+
+	if err := enc.WriteHeaderFrom(&Header{Config: image.Config{Width: width, Height: height}}); err != nil {
+		return err
+	}
+	if opts.LoopCount >= 0 {
+		if err := enc.WriteApplicationNetscape(&ApplicationNetscape{LoopCount: opts.LoopCount}); err != nil {
+			return err
+		}
+	}
+
+	screen := image.Rect(0, 0, width, height)
+	w := newFrameWriter(enc, true)
+	for i, dec := range decs {
+		c := NewCoalescer(hdrs[i].Config)
+		r := opts.placement(sizes[i], screen)
+		for {
+			blk, err := dec.ReadBlock()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			if pt, ok := blk.(*PlainText); ok {
+				gp, _ := hdrs[i].Config.ColorModel.(color.Palette)
+				blk = pt.Frame(gp)
+			}
+			switch blk := blk.(type) {
+			case *Frame:
+				// the Coalescer only keeps the frame to change its disposal method
+				f := c.Coalesce(blk)
+				f.Image = composite(f.Image, r, screen, opts.Filter, w.fo)
+				err = w.frame(context.Background(), f)
+			case *Comment, *UnknownApplication, *UnknownExtension:
+				err = w.block(blk)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if w.held != nil && i < len(decs)-1 {
+			// clear the whole screen before the next input
+			w.held.DisposalMethod = DisposalBackground
+		}
+	}
+
+	if err := w.flush(context.Background()); err != nil {
+		return err
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// placement returns where an input of the given size is drawn on the given screen.
+func (o *ConcatOptions) placement(size image.Point, screen image.Rectangle) image.Rectangle {
+	w, h := size.X, size.Y
+	switch o.Fit {
+	case FitLetterbox:
+		if w > 0 && h > 0 {
+			s := math.Min(float64(screen.Dx())/float64(w), float64(screen.Dy())/float64(h))
+			w = max(int(math.Round(float64(w)*s)), 1)
+			h = max(int(math.Round(float64(h)*s)), 1)
+		}
+	case FitStretch:
+		w, h = screen.Dx(), screen.Dy()
+	}
+	x, y := (screen.Dx()-w)/2, (screen.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// composite scales the given full input frame to the given rectangle and draws it on a new
+// full logical screen image, transparent elsewhere where the palette allows.
+func composite(pm *image.Paletted, r, screen image.Rectangle, f Filter, fo *frameOptimizer) *image.Paletted {
+	if r.Dx() != pm.Rect.Dx() || r.Dy() != pm.Rect.Dy() {
+		pm = resizePaletted(pm, r.Dx(), r.Dy(), f)
+	}
+
+	p, ti := fo.transparent(pm.Palette)
+	if ti < 0 {
+		ti = p.Index(color.Black)
+	}
+	dst := image.NewPaletted(screen, p)
+	if ti != 0 {
+		for i := range dst.Pix {
+			dst.Pix[i] = uint8(ti)
+		}
+	}
+	vis := r.Intersect(screen)
+	for y := vis.Min.Y; y < vis.Max.Y; y++ {
+		i := pm.PixOffset(pm.Rect.Min.X+vis.Min.X-r.Min.X, pm.Rect.Min.Y+y-r.Min.Y)
+		copy(dst.Pix[dst.PixOffset(vis.Min.X, y):], pm.Pix[i:i+vis.Dx()])
+	}
+	return dst
+}
@@ -0,0 +1,133 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	green := color.RGBA{G: 0xff, A: 0xff}
+	uniform := func(w, h int, p color.Palette, idx uint8) *image.Paletted {
+		pm := image.NewPaletted(image.Rect(0, 0, w, h), p)
+		for i := range pm.Pix {
+			pm.Pix[i] = idx
+		}
+		return pm
+	}
+	encode := func(g *GIF) *Decoder {
+		t.Helper()
+		buf := &bytes.Buffer{}
+		if err := EncodeAll(buf, g); err != nil {
+			t.Fatal("EncodeAll:", err)
+		}
+		return NewDecoder(buf)
+	}
+
+	testCases := []struct {
+		name          string
+		opts          ConcatOptions
+		width, height int
+		green         image.Rectangle
+	}{
+		{"center", ConcatOptions{Fit: FitCenter, LoopCount: 2}, 4, 2, image.Rect(1, 0, 3, 2)},
+		{"letterbox", ConcatOptions{Width: 8, Height: 4, Fit: FitLetterbox}, 8, 4, image.Rect(2, 0, 6, 4)},
+		{"stretch", ConcatOptions{Width: 8, Height: 4, Fit: FitStretch, LoopCount: -1}, 8, 4, image.Rect(0, 0, 8, 4)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pa := color.Palette{red, white}
+			a := &GIF{
+				Image:     []*image.Paletted{uniform(4, 2, pa, 0), uniform(4, 2, pa, 1)},
+				Delay:     []int{10, 20},
+				LoopCount: 5,
+				Config:    image.Config{Width: 4, Height: 2, ColorModel: pa},
+			}
+			pb := color.Palette{green}
+			b := &GIF{
+				Image:  []*image.Paletted{uniform(2, 2, pb, 0)},
+				Delay:  []int{30},
+				Config: image.Config{Width: 2, Height: 2, ColorModel: pb},
+			}
+
+			buf := &bytes.Buffer{}
+			opts := tc.opts
+			if err := Concat(NewEncoder(buf), &opts, encode(a), encode(b)); err != nil {
+				t.Fatal("Concat:", err)
+			}
+			g, err := DecodeAll(buf)
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			if g.Config.Width != tc.width || g.Config.Height != tc.height {
+				t.Fatal("unexpected screen size:", g.Config.Width, g.Config.Height)
+			}
+			if g.LoopCount != tc.opts.LoopCount {
+				t.Fatal("unexpected loop count:", g.LoopCount)
+			}
+			if len(g.Image) != 3 || g.Delay[0] != 10 || g.Delay[1] != 20 || g.Delay[2] != 30 {
+				t.Fatal("unexpected frames:", len(g.Image), g.Delay)
+			}
+
+			c := Coalesce(g)
+			wants := []color.Color{red, white}
+			for i, want := range wants {
+				for y := 0; y < tc.height; y++ {
+					for x := 0; x < tc.width; x++ {
+						if got := c.Image[i].At(x, y); colorKey(got) != colorKey(want) {
+							t.Fatal("frame", i, "unexpected pixel", x, y, "got:", got, "want:", want)
+						}
+					}
+				}
+			}
+			for y := 0; y < tc.height; y++ {
+				for x := 0; x < tc.width; x++ {
+					want := color.Color(color.Transparent)
+					if image.Pt(x, y).In(tc.green) {
+						want = green
+					}
+					if got := c.Image[2].At(x, y); colorKey(got) != colorKey(want) {
+						t.Fatal("frame 2 unexpected pixel", x, y, "got:", got, "want:", want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConcatCorrectAspect(t *testing.T) {
+	green := color.RGBA{G: 0xff, A: 0xff}
+	pm := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{green})
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, &GIF{Image: []*image.Paletted{pm}, Delay: []int{0}}); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	// pixels twice as wide as they are tall
+	buf.Bytes()[12] = 113
+
+	for _, correct := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		opts := &ConcatOptions{CorrectAspect: correct, LoopCount: -1}
+		if err := Concat(NewEncoder(out), opts, NewDecoder(bytes.NewReader(buf.Bytes()))); err != nil {
+			t.Fatal("Concat:", err)
+		}
+		g, err := DecodeAll(out)
+		if err != nil {
+			t.Fatal("DecodeAll:", err)
+		}
+		want := image.Pt(2, 2)
+		if correct {
+			want = image.Pt(4, 2)
+		}
+		if got := image.Pt(g.Config.Width, g.Config.Height); got != want {
+			t.Fatal("unexpected screen size:", got, "want:", want)
+		}
+		c := Coalesce(g).Image[0]
+		if got := c.At(want.X-1, want.Y-1); colorKey(got) != colorKey(green) {
+			t.Fatal("unexpected pixel:", got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package gif
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// contextCheckInterval is the number of bytes read or written between cancellation checks
+// while processing a block, bounding how much LZW data is handled after cancellation.
+const contextCheckInterval = 1 << 10
+
+// DecodeContext is like Decode, but returns the context's error as soon as it is done, checking
+// between blocks and periodically while decoding image data. The decoder can't be used after
+// cancellation.
+func (d *Decoder) DecodeContext(ctx context.Context) (*GIF, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d.loopCount = -1
+	hdr, err := d.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GIF{Config: hdr.Config, BackgroundIndex: hdr.BackgroundIndex, LoopCount: -1}
+	for {
+		if b, err := d.ReadBlockContext(ctx); err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			if len(g.Image) == 0 {
+				return nil, fmt.Errorf("gif: missing image data")
+			}
+			return g, nil
+		} else {
+			switch b := b.(type) {
+			case *ApplicationNetscape:
+				g.LoopCount = b.LoopCount
+			case *Frame:
+				g.Image = append(g.Image, b.Image)
+				g.Delay = append(g.Delay, int(b.DelayTime/(10*time.Millisecond)))
+				g.Disposal = append(g.Disposal, b.DisposalMethod)
+			}
+		}
+	}
+}
+
+// ReadBlockContext is like ReadBlock, but returns the context's error as soon as it is done,
+// checking before reading and periodically while decoding image data. The decoder can't be used
+// after cancellation, since the block may have been partially read.
+func (d *Decoder) ReadBlockContext(ctx context.Context) (any, error) {
+	if ctx.Done() == nil {
+		return d.ReadBlock()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r := d.r
+	d.r = &contextReader{reader: r, ctx: ctx}
+	blk, err := d.ReadBlock()
+	d.r = r
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return blk, err
+}
+
+// WriteFrameContext is like WriteFrame, but returns the context's error as soon as it is done,
+// checking before writing and periodically while encoding image data. The encoder can't be used
+// after cancellation, since the frame may have been partially written.
+func (e *Encoder) WriteFrameContext(ctx context.Context, f *Frame) error {
+	if ctx.Done() == nil {
+		return e.WriteFrame(f)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := e.state()
+	s.writer = &contextWriter{writer: s.writer, ctx: ctx}
+	err := e.WriteFrame(f)
+	if cw, ok := s.writer.(*contextWriter); ok {
+		s.writer = cw.writer
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// contextReader fails once its context is done, checking every contextCheckInterval bytes.
+type contextReader struct {
+	reader
+	ctx context.Context
+	n   int
+}
+
+func (r *contextReader) check(n int) error {
+	if r.n += n; r.n >= contextCheckInterval {
+		r.n = 0
+		return r.ctx.Err()
+	}
+	return nil
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.check(len(p)); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+func (r *contextReader) ReadByte() (byte, error) {
+	if err := r.check(1); err != nil {
+		return 0, err
+	}
+	return r.reader.ReadByte()
+}
+
+// contextWriter fails once its context is done, checking every contextCheckInterval bytes.
+type contextWriter struct {
+	writer
+	ctx context.Context
+	n   int
+}
+
+func (w *contextWriter) check(n int) error {
+	if w.n += n; w.n >= contextCheckInterval {
+		w.n = 0
+		return w.ctx.Err()
+	}
+	return nil
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.check(len(p)); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(p)
+}
+
+func (w *contextWriter) WriteByte(c byte) error {
+	if err := w.check(1); err != nil {
+		return err
+	}
+	return w.writer.WriteByte(c)
+}
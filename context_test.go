@@ -0,0 +1,159 @@
+package gif
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// noisyFrame returns a frame whose pixels don't compress, so its image data is large.
+func noisyFrame(size int) *Frame {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.RGBA{uint8(i), uint8(i), uint8(i), 0xff}
+	}
+	pm := image.NewPaletted(image.Rect(0, 0, size, size), p)
+	x := uint32(1)
+	for i := range pm.Pix {
+		x = x*1103515245 + 12345
+		pm.Pix[i] = uint8(x >> 16)
+	}
+	return &Frame{Image: pm}
+}
+
+// cancelReader cancels a context once a number of bytes have been read.
+type cancelReader struct {
+	*bytes.Reader
+	cancel func()
+	after  int
+	n      int
+}
+
+func (r *cancelReader) count(n int) {
+	if r.n += n; r.n >= r.after {
+		r.cancel()
+	}
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.count(n)
+	return n, err
+}
+
+func (r *cancelReader) ReadByte() (byte, error) {
+	r.count(1)
+	return r.Reader.ReadByte()
+}
+
+func TestReadBlockContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeader(image.Config{Width: 256, Height: 256}, 0); err != nil {
+		t.Fatal("WriteHeader:", err)
+	}
+	if err := enc.WriteFrame(noisyFrame(256)); err != nil {
+		t.Fatal("WriteFrame:", err)
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+	data := buf.Bytes()
+
+	// cancelled partway through the image data
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &cancelReader{Reader: bytes.NewReader(data), cancel: cancel, after: len(data) / 4}
+	dec := NewDecoder(r)
+	if _, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	if _, err := dec.ReadBlockContext(ctx); err != context.Canceled {
+		t.Fatal("expected canceled, got", err)
+	}
+	if r.n > len(data)/4+2*contextCheckInterval {
+		t.Fatal("read too far after cancellation:", r.n)
+	}
+
+	// already cancelled
+	if _, err := NewDecoder(bytes.NewReader(data)).DecodeContext(ctx); err != context.Canceled {
+		t.Fatal("expected canceled, got", err)
+	}
+
+	want, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal("Decode:", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	got, err := NewDecoder(bytes.NewReader(data)).DecodeContext(ctx)
+	if err != nil {
+		t.Fatal("DecodeContext:", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("DecodeContext differs from Decode")
+	}
+}
+
+// cancelWriter cancels a context once a number of bytes have been written.
+type cancelWriter struct {
+	bytes.Buffer
+	cancel func()
+	after  int
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	if w.Len() >= w.after {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *cancelWriter) WriteByte(c byte) error {
+	if w.Len() >= w.after {
+		w.cancel()
+	}
+	return w.Buffer.WriteByte(c)
+}
+
+func (w *cancelWriter) Flush() error {
+	return nil
+}
+
+func TestWriteFrameContext(t *testing.T) {
+	for _, vers := range []string{version89a, ""} {
+		t.Run(vers, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w := &cancelWriter{cancel: cancel, after: 16 << 10}
+			enc := NewEncoder(w)
+			if err := enc.WriteHeaderFrom(&Header{Version: vers, Config: image.Config{Width: 256, Height: 256}}); err != nil {
+				t.Fatal("WriteHeaderFrom:", err)
+			}
+			// the first frame is written in full, releasing any held header
+			f := noisyFrame(64)
+			f.DelayTime = time.Second
+			if err := enc.WriteFrameContext(ctx, f); err != nil {
+				t.Fatal("WriteFrameContext:", err)
+			}
+			if err := enc.WriteFrameContext(ctx, noisyFrame(256)); err != context.Canceled {
+				t.Fatal("expected canceled, got", err)
+			}
+			if n := w.Len(); n > 16<<10+2*contextCheckInterval {
+				t.Fatal("wrote too far after cancellation:", n)
+			}
+			if _, ok := enc.state().writer.(*contextWriter); ok {
+				t.Fatal("writer not restored")
+			}
+			if err := enc.WriteFrameContext(ctx, noisyFrame(1)); err != context.Canceled {
+				t.Fatal("expected canceled, got", err)
+			}
+		})
+	}
+}
@@ -2,17 +2,24 @@ package gif
 
 import (
 	"bufio"
+	"compress/lzw"
+	"context"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	"io"
+	"math"
+	"sync"
 	"time"
 )
 
 type (
 	Header struct {
-		Version         string       // GIF version, either GIF87a or GIF89a.
+		Version         string       // GIF version, either GIF87a or GIF89a, or empty to select automatically when encoding.
 		Config          image.Config // Global color table (palette), width and height.
 		BackgroundIndex byte         // Background index in the global color table, for use with the DisposalBackground disposal method.
+		AspectRatio     byte         // Pixel aspect ratio as stored in the logical screen descriptor, zero if not specified.
 	}
 	PlainText struct {
 		TextGridLeftPosition     uint16
@@ -60,33 +67,7 @@ func NewDecoder(r io.Reader) *Decoder {
 type Decoder = decoder
 
 func (d *Decoder) Decode() (*GIF, error) {
-	d.loopCount = -1
-	hdr, err := d.ReadHeader()
-	if err != nil {
-		return nil, err
-	}
-
-	g := &GIF{Config: hdr.Config, BackgroundIndex: hdr.BackgroundIndex, LoopCount: -1}
-	for {
-		if b, err := d.ReadBlock(); err != nil {
-			if err != io.EOF {
-				return nil, err
-			}
-			if len(g.Image) == 0 {
-				return nil, fmt.Errorf("gif: missing image data")
-			}
-			return g, nil
-		} else {
-			switch b := b.(type) {
-			case *ApplicationNetscape:
-				g.LoopCount = b.LoopCount
-			case *Frame:
-				g.Image = append(g.Image, b.Image)
-				g.Delay = append(g.Delay, int(b.DelayTime/(10*time.Millisecond)))
-				g.Disposal = append(g.Disposal, b.DisposalMethod)
-			}
-		}
-	}
+	return d.DecodeContext(context.Background())
 }
 
 func (d *Decoder) DecodeFirst() (image.Image, error) {
@@ -118,7 +99,8 @@ func (d *Decoder) DecodeConfig() (image.Config, error) {
 }
 
 func (d *Decoder) ReadHeader() (*Header, error) {
-	if err := d.readHeaderAndScreenDescriptor(); err != nil {
+	aspectRatio, err := d.readHeaderAndScreenDescriptor_()
+	if err != nil {
 		return nil, err
 	}
 	return &Header{
@@ -129,10 +111,96 @@ func (d *Decoder) ReadHeader() (*Header, error) {
 			Height:     d.height,
 		},
 		BackgroundIndex: d.backgroundIndex,
+		AspectRatio:     aspectRatio,
 	}, nil
 }
 
+func (d *Decoder) readHeaderAndScreenDescriptor_() (byte, error) {
+	if err := readFull(d.r, d.tmp[:13]); err != nil {
+		return 0, fmt.Errorf("gif: reading header: %v", err)
+	}
+	d.vers = string(d.tmp[:6])
+	if d.vers != version87a && d.vers != version89a {
+		return 0, fmt.Errorf("gif: can't recognize format %q", d.vers)
+	}
+	d.width = int(leUint16(d.tmp[6:8]))
+	d.height = int(leUint16(d.tmp[8:10]))
+	aspectRatio := d.tmp[12]
+	if fields := d.tmp[10]; fields&fColorTable != 0 {
+		d.backgroundIndex = d.tmp[11]
+		if ct, err := d.readColorTable(fields); err != nil {
+			return 0, err
+		} else {
+			d.globalColorTable = ct
+		}
+	}
+	return aspectRatio, nil
+}
+
+// PixelAspectRatio returns the pixel width divided by the pixel height, or 1 if not specified.
+func (h *Header) PixelAspectRatio() float64 {
+	if h.AspectRatio == 0 {
+		return 1
+	}
+	return (float64(h.AspectRatio) + 15) / 64
+}
+
+// SetPixelAspectRatio stores the nearest representable aspect ratio, or zero for square pixels.
+func (h *Header) SetPixelAspectRatio(r float64) {
+	if n := math.Round(r*64 - 15); r == 1 || n < 1 {
+		h.AspectRatio = 0
+	} else if n > 0xff {
+		h.AspectRatio = 0xff
+	} else {
+		h.AspectRatio = byte(n)
+	}
+}
+
+// DisplaySize returns the logical screen size stretched to correct for non-square pixels.
+// Dimensions are only ever enlarged so that no image detail is lost.
+func (h *Header) DisplaySize() image.Point {
+	p := image.Pt(h.Config.Width, h.Config.Height)
+	if r := h.PixelAspectRatio(); r > 1 {
+		p.X = int(math.Round(float64(p.X) * r))
+	} else if r < 1 {
+		p.Y = int(math.Round(float64(p.Y) / r))
+	}
+	return p
+}
+
+// IsGlobalTable reports whether the given palette, typically that of a decoded frame, is the
+// global color table rather than a local one.
+func (h *Header) IsGlobalTable(p color.Palette) bool {
+	gp, _ := h.Config.ColorModel.(color.Palette)
+	return globalTable(gp, p)
+}
+
+// globalTable reports whether the palette is the global color table, allowing for the
+// transparent entry that the decoder substitutes into a copy of it.
+func globalTable(gp, p color.Palette) bool {
+	if len(gp) == 0 || len(gp) != len(p) {
+		return false
+	}
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a != 0 && colorKey(c) != colorKey(gp[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (d *Decoder) ReadBlock() (any, error) {
+	return d.readBlockInfo(nil)
+}
+
+// blockInfo records how the blocks returned by readBlockInfo are stored in the file.
+type blockInfo struct {
+	control bool // A graphic control extension preceded the block, cleared by the caller.
+	fields  byte // Image descriptor fields of the last frame.
+}
+
+// readBlockInfo is ReadBlock, also recording in info how the returned block is stored.
+func (d *Decoder) readBlockInfo(info *blockInfo) (any, error) {
 	for {
 		c, err := readByte(d.r)
 		if err != nil {
@@ -141,9 +209,14 @@ func (d *Decoder) ReadBlock() (any, error) {
 
 		switch c {
 		case sExtension:
-			if e, err := d.readExtension_(); e != nil || err != nil {
+			e, err := d.readExtension_()
+			if e != nil || err != nil {
 				return e, err
 			}
+			// only graphic control extensions return neither a block nor an error
+			if info != nil {
+				info.control = true
+			}
 
 		case sImageDescriptor:
 			if err = d.readImageDescriptor(false); err != nil {
@@ -157,9 +230,14 @@ func (d *Decoder) ReadBlock() (any, error) {
 			d.image = d.image[:0]
 			d.delay = d.delay[:0]
 			d.disposal = d.disposal[:0]
+			if info != nil {
+				info.fields = d.imageFields
+			}
+			d.reportProgress(true)
 			return f, nil
 
 		case sTrailer:
+			d.reportProgress(false)
 			return nil, io.EOF
 
 		default:
@@ -168,6 +246,197 @@ func (d *Decoder) ReadBlock() (any, error) {
 	}
 }
 
+// ReadFrameInto reads blocks up to and including the next frame, skipping any others, and
+// decodes the frame into dst rather than allocating a new image. It returns io.EOF once the
+// trailer is reached. The Pix and Palette storage of dst are reused when large enough, except
+// for the global color table that frames from ReadBlock share, so once dst has grown to fit,
+// decoding doesn't allocate, and the frame is returned by value for the same reason. Only
+// local color table entries that differ from those of the previous frame decoded into dst are
+// allocated.
+//
+// The returned frame's Image is dst, which the caller continues to own. Its pixels and palette
+// entries are overwritten in place by the next call given dst, so anything that must outlive
+// that, including the palette, must be copied first. Use a separate dst for frames that are
+// held at the same time, such as when coalescing.
+func (d *Decoder) ReadFrameInto(dst *image.Paletted) (Frame, error) {
+	for {
+		c, err := readByte(d.r)
+		if err != nil {
+			return Frame{}, fmt.Errorf("gif: reading block: %v", err)
+		}
+
+		switch c {
+		case sExtension:
+			if _, err := d.readExtension_(); err != nil {
+				return Frame{}, err
+			}
+
+		case sImageDescriptor:
+			if err := d.readImageDescriptor_(dst, false); err != nil {
+				return Frame{}, err
+			}
+			f := Frame{
+				Image:          dst,
+				DelayTime:      time.Duration(d.delayTime) * 10 * time.Millisecond,
+				DisposalMethod: d.disposalMethod,
+			}
+			d.delayTime = 0
+			d.hasTransparentIndex = false
+			d.reportProgress(true)
+			return f, nil
+
+		case sTrailer:
+			d.reportProgress(false)
+			return Frame{}, io.EOF
+
+		default:
+			return Frame{}, fmt.Errorf("gif: unknown block type: 0x%.2x", c)
+		}
+	}
+}
+
+// frameReaders holds LZW decoding state reused by readImageDescriptor_.
+var frameReaders = sync.Pool{New: func() any { return new(frameReader) }}
+
+type frameReader struct {
+	br  blockReader
+	lzw *lzw.Reader
+}
+
+// transparentRGBA is stored in palettes as an interface value, which doesn't allocate.
+var transparentRGBA color.Color = color.RGBA{}
+
+// readImageDescriptor_ follows readImageDescriptor, but decodes into storage reused from dst,
+// with pooled LZW readers and interlaced rows read straight into place. If skip is set, the
+// image data is read past without being decompressed and dst is unused.
+func (d *Decoder) readImageDescriptor_(dst *image.Paletted, skip bool) error {
+	if err := readFull(d.r, d.tmp[:9]); err != nil {
+		return fmt.Errorf("gif: can't read image descriptor: %s", err)
+	}
+	left := int(d.tmp[0]) + int(d.tmp[1])<<8
+	top := int(d.tmp[2]) + int(d.tmp[3])<<8
+	width := int(d.tmp[4]) + int(d.tmp[5])<<8
+	height := int(d.tmp[6]) + int(d.tmp[7])<<8
+	d.imageFields = d.tmp[8]
+	if left+width > d.width || top+height > d.height {
+		return errors.New("gif: frame bounds larger than image bounds")
+	}
+
+	// the color table is read into d.tmp, which the block reader reuses
+	var rgb []byte
+	if d.imageFields&fColorTable != 0 {
+		n := 1 << (1 + uint(d.imageFields&fColorTableBitsMask))
+		if err := readFull(d.r, d.tmp[:3*n]); err != nil {
+			return fmt.Errorf("gif: reading color table: %s", err)
+		}
+		rgb = d.tmp[:3*n]
+	} else if d.globalColorTable == nil {
+		return errors.New("gif: no color table")
+	}
+	if skip {
+		if _, err := readByte(d.r); err != nil {
+			return fmt.Errorf("gif: reading image data: %v", err)
+		}
+		for {
+			if n, err := d.readBlock(); err != nil {
+				return fmt.Errorf("gif: reading image data: %v", err)
+			} else if n == 0 {
+				return nil
+			}
+		}
+	}
+
+	if n := width * height; cap(dst.Pix) < n {
+		dst.Pix = make([]uint8, n)
+	} else {
+		dst.Pix = dst.Pix[:n]
+	}
+	dst.Stride = width
+	dst.Rect = image.Rect(left, top, left+width, top+height)
+
+	// frames from ReadBlock share the global color table, which mustn't be overwritten
+	p := dst.Palette[:0]
+	if cap(p) < 256 || len(d.globalColorTable) > 0 && &p[:1][0] == &d.globalColorTable[0] {
+		p = make(color.Palette, 0, 256)
+	}
+	if rgb != nil {
+		p = p[:len(rgb)/3]
+		for i, j := 0, 0; i < len(p); i, j = i+1, j+3 {
+			// only replace entries that differ, as storing a new color allocates
+			if c := (color.RGBA{rgb[j+0], rgb[j+1], rgb[j+2], 0xFF}); p[i] != c && (!d.hasTransparentIndex || i != int(d.transparentIndex)) {
+				p[i] = c
+			}
+		}
+	} else {
+		p = p[:len(d.globalColorTable)]
+		copy(p, d.globalColorTable)
+	}
+	if d.hasTransparentIndex {
+		// as in readImageDescriptor, the palette grows to include an out of range index
+		ti := int(d.transparentIndex)
+		for len(p) <= ti {
+			p = append(p, transparentRGBA)
+		}
+		p[ti] = transparentRGBA
+	}
+	dst.Palette = p
+
+	litWidth, err := readByte(d.r)
+	if err != nil {
+		return fmt.Errorf("gif: reading image data: %v", err)
+	}
+	if litWidth < 2 || litWidth > 8 {
+		return fmt.Errorf("gif: pixel size in decode out of range: %d", litWidth)
+	}
+	fr := frameReaders.Get().(*frameReader)
+	defer frameReaders.Put(fr)
+	fr.br = blockReader{d: d}
+	defer func() { fr.br = blockReader{} }()
+	if fr.lzw == nil {
+		fr.lzw = lzw.NewReader(&fr.br, lzw.LSB, int(litWidth)).(*lzw.Reader)
+	} else {
+		fr.lzw.Reset(&fr.br, lzw.LSB, int(litWidth))
+	}
+
+	if d.imageFields&fInterlace != 0 {
+		for _, pass := range interlacing {
+			for y := pass.start; y < height && err == nil; y += pass.skip {
+				err = readFull(fr.lzw, dst.Pix[y*width:(y+1)*width])
+			}
+		}
+	} else {
+		err = readFull(fr.lzw, dst.Pix)
+	}
+	if err != nil {
+		if err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("gif: reading image data: %v", err)
+		}
+		return errNotEnough
+	}
+	// as in readImageDescriptor, the LZW stream may lack an end code and the sub-blocks may
+	// hold an extra byte
+	if n, err := fr.lzw.Read(d.tmp[256:257]); n != 0 || (err != io.EOF && err != io.ErrUnexpectedEOF) {
+		if err != nil {
+			return fmt.Errorf("gif: reading image data: %v", err)
+		}
+		return errTooMuch
+	}
+	if err := fr.br.close(); err == errTooMuch {
+		return errTooMuch
+	} else if err != nil {
+		return fmt.Errorf("gif: reading image data: %v", err)
+	}
+
+	if len(p) < 256 {
+		for _, pixel := range dst.Pix {
+			if int(pixel) >= len(p) {
+				return errBadPixel
+			}
+		}
+	}
+	return nil
+}
+
 func (d *Decoder) readExtension_() (any, error) {
 	label, err := readByte(d.r)
 	if err != nil {
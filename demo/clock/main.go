@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
-	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -13,13 +13,13 @@ import (
 	"time"
 
 	"github.com/NathanBaulch/gifx"
+	"github.com/NathanBaulch/gifx/gifhttp"
 )
 
 var (
 	//go:embed 7segment.png
-	ssBytes      []byte
-	ssImage      *image.Paletted
-	ssTransIndex uint8
+	ssBytes []byte
+	ssImage *image.Paletted
 )
 
 const (
@@ -34,79 +34,71 @@ func main() {
 		ssImage = im.(*image.Paletted)
 	}
 
+	// frames are only optimized when the palette has a transparent entry
 	found := false
-	for i, c := range ssImage.Palette {
+	for _, c := range ssImage.Palette {
 		if _, _, _, a := c.RGBA(); a == 0 {
 			found = true
-			ssTransIndex = uint8(i)
 		}
 	}
 	if !found {
 		if len(ssImage.Palette) == 0xff {
 			panic("no space for transparent entry in image palette")
 		}
-		ssTransIndex = uint8(len(ssImage.Palette))
 		ssImage.Palette = append(ssImage.Palette, color.Transparent)
 	}
 
-	http.HandleFunc("/time", handleTime)
-	http.HandleFunc("/stopwatch", handleStopwatch)
-	http.HandleFunc("/timer", handleTimer)
+	http.Handle("/time", gifhttp.NewHandler(func(*http.Request) (gif.FrameSource, error) {
+		return newSource(func() time.Time { return time.Now() }), nil
+	}, nil))
+	http.Handle("/stopwatch", gifhttp.NewHandler(func(*http.Request) (gif.FrameSource, error) {
+		start := time.Now()
+		zero := time.Time{}
+		return newSource(func() time.Time { return zero.Add(time.Since(start)) }), nil
+	}, nil))
+	http.Handle("/timer", gifhttp.NewHandler(func(req *http.Request) (gif.FrameSource, error) {
+		d, err := time.ParseDuration(req.FormValue("d"))
+		if err != nil {
+			return nil, err
+		}
+		rem := time.Time{}.Add(d)
+		return newSource(func() time.Time {
+			t := rem
+			rem = rem.Add(-time.Second)
+			return t
+		}), nil
+	}, nil))
 	if err := http.ListenAndServe(":8090", nil); err != nil {
 		panic(err)
 	}
 }
 
-func handleTime(w http.ResponseWriter, req *http.Request) {
-	handle(w, req, func() time.Time { return time.Now() })
-}
-
-func handleStopwatch(w http.ResponseWriter, req *http.Request) {
-	start := time.Now()
-	zero := time.Time{}
-	handle(w, req, func() time.Time { return zero.Add(time.Since(start)) })
-}
-
-func handleTimer(w http.ResponseWriter, req *http.Request) {
-	d, err := time.ParseDuration(req.FormValue("d"))
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = fmt.Fprintln(w, err.Error())
-		return
-	}
-
-	rem := time.Time{}.Add(d)
-	handle(w, req, func() time.Time {
-		t := rem
-		rem = rem.Add(-time.Second)
-		return t
-	})
-}
-
-func handle(w http.ResponseWriter, req *http.Request, fn func() time.Time) {
-	w.Header().Set("content-type", "image/gif")
-	w.Header().Set("cache-control", "no-store")
-
+// newSource returns a source that draws the time returned by fn once a second, only redrawing
+// the digits that changed, until the time is negative.
+func newSource(fn func() time.Time) gif.FrameSource {
 	rect := image.Rect(0, 0, 6*ssDigitWidth+2*ssColonWidth, ssImage.Rect.Max.Y)
-	enc := gif.NewEncoder(&flushWriter{w})
-	if err := enc.WriteHeader(image.Config{Width: rect.Max.X, Height: rect.Max.Y, ColorModel: ssImage.Palette}, 0); err != nil {
-		panic(err)
-	}
-
 	pm := image.NewPaletted(rect, ssImage.Palette)
-	ticker := time.NewTicker(time.Second)
-
+	var ticker *time.Ticker
 	var prev []byte
-	opt := gif.NewOptimizer(ssTransIndex)
-loop:
-	for {
+	return gif.ImageFunc(func(ctx context.Context) (image.Image, error) {
+		if ticker == nil {
+			ticker = time.NewTicker(time.Second)
+		} else {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return nil, ctx.Err()
+			case <-ticker.C:
+			}
+		}
+
 		t := fn()
 		if t.Before(time.Time{}) {
-			break
+			ticker.Stop()
+			return nil, io.EOF
 		}
 		this := []byte(t.Format("15:04:05"))
 		x := 0
-		var crop image.Rectangle
 		for i, s := range this {
 			width := ssDigitWidth
 			if s == ':' {
@@ -115,44 +107,10 @@ loop:
 			if len(prev) <= i || prev[i] != s {
 				r := image.Rect(x, 0, x+width, ssImage.Rect.Max.Y)
 				draw.Draw(pm, r, ssImage, image.Pt((int(s)-48)*ssDigitWidth, 0), draw.Over)
-				crop = crop.Union(r)
 			}
 			x += width
 		}
-		pm, _ := opt.Optimize(pm.SubImage(crop).(*image.Paletted))
-		if err := enc.WriteFrame(&gif.Frame{Image: pm, DelayTime: time.Second}); err != nil {
-			panic(err)
-		}
-		if err := enc.Flush(); err != nil {
-			panic(err)
-		}
-
-		select {
-		case <-req.Context().Done():
-			break loop
-		case <-ticker.C:
-			prev = this
-		}
-	}
-
-	if err := enc.WriteTrailer(); err != nil {
-		panic(err)
-	}
-	if err := enc.Flush(); err != nil {
-		panic(err)
-	}
-}
-
-type flushWriter struct {
-	io.Writer
-}
-
-func (w *flushWriter) WriteByte(c byte) error {
-	_, err := w.Write([]byte{c})
-	return err
-}
-
-func (w *flushWriter) Flush() error {
-	w.Writer.(http.Flusher).Flush()
-	return nil
+		prev = this
+		return pm, nil
+	}, time.Second)
 }
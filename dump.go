@@ -0,0 +1,525 @@
+package gif
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"time"
+)
+
+// DumpOptions are the parameters for Dump.
+type DumpOptions struct {
+	// JSON selects the JSON description read by Assemble, rather than plain text.
+	JSON bool
+	// Image, if not nil, is called to store the pixels of each frame externally, typically as
+	// a PNG file, and returns the reference to record in the description. Otherwise pixels are
+	// written inline as hex, one string per row.
+	Image func(index int, pm *image.Paletted) (string, error)
+}
+
+// Dump writes a description of every block returned by the given decoder, including extension
+// sub-blocks, one block at a time. The plain text form is intended for reading, while the
+// JSON form can be edited and turned back into a GIF with Assemble. Blocks are described as
+// stored, so a frame only has a palette if it has a local color table, even one that matches
+// the global table, and a block without a graphic control extension has no delay or disposal
+// method, although decoders carry the previous disposal method over to it.
+func Dump(w io.Writer, dec *Decoder, opts *DumpOptions) error {
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	gp, _ := hdr.Config.ColorModel.(color.Palette)
+	dh := &dumpHeader{
+		Version:         hdr.Version,
+		Width:           hdr.Config.Width,
+		Height:          hdr.Config.Height,
+		BackgroundIndex: hdr.BackgroundIndex,
+		AspectRatio:     hdr.AspectRatio,
+		Palette:         dumpPalette(gp),
+	}
+	if opts.JSON {
+		fmt.Fprint(bw, `{"header":`)
+		if err := json.NewEncoder(bw).Encode(dh); err != nil {
+			return err
+		}
+		fmt.Fprint(bw, `,"blocks":[`)
+	} else {
+		dh.writeText(bw)
+	}
+
+	frames := 0
+	var info blockInfo
+	for i := 0; ; i++ {
+		blk, err := dec.readBlockInfo(&info)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		db, err := newDumpBlock(blk, &info, frames, opts)
+		if err != nil {
+			return err
+		}
+		switch db.Type {
+		case "frame":
+			frames++
+			info = blockInfo{}
+		case "plainText":
+			info = blockInfo{}
+		}
+		if opts.JSON {
+			if i > 0 {
+				fmt.Fprint(bw, ",")
+			}
+			if err := json.NewEncoder(bw).Encode(db); err != nil {
+				return err
+			}
+		} else {
+			db.writeText(bw)
+		}
+	}
+
+	if opts.JSON {
+		fmt.Fprintln(bw, "]}")
+	} else {
+		fmt.Fprintln(bw, "trailer")
+	}
+	return bw.Flush()
+}
+
+// AssembleOptions are the parameters for Assemble.
+type AssembleOptions struct {
+	// Image is called to load frame pixels referenced by the description. Paletted images
+	// provide palette indexes directly, while other images are mapped onto the frame palette.
+	Image func(ref string) (image.Image, error)
+}
+
+// Assemble reads a JSON description in the form written by Dump and writes each block to the
+// given encoder using its Write methods, followed by the trailer. The block sequence and all
+// values are reproduced, although the bytes may differ where the encoder makes its own choices,
+// for example by omitting a local color table that matches the global one or not interlacing.
+func Assemble(enc *Encoder, r io.Reader, opts *AssembleOptions) error {
+	if opts == nil {
+		opts = &AssembleOptions{}
+	}
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	var gp color.Palette
+	haveHeader := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "header":
+			var dh dumpHeader
+			if err := dec.Decode(&dh); err != nil {
+				return err
+			}
+			if gp, err = parsePalette(dh.Palette); err != nil {
+				return err
+			}
+			hdr := &Header{
+				Version:         dh.Version,
+				Config:          image.Config{Width: dh.Width, Height: dh.Height},
+				BackgroundIndex: dh.BackgroundIndex,
+				AspectRatio:     dh.AspectRatio,
+			}
+			if gp != nil {
+				hdr.Config.ColorModel = gp
+			}
+			if err := enc.WriteHeaderFrom(hdr); err != nil {
+				return err
+			}
+			haveHeader = true
+		case "blocks":
+			if !haveHeader {
+				return errors.New("gif: assemble: blocks before header")
+			}
+			if err := expectDelim(dec, '['); err != nil {
+				return err
+			}
+			for dec.More() {
+				var db dumpBlock
+				if err := dec.Decode(&db); err != nil {
+					return err
+				}
+				if err := db.write(enc, gp, opts); err != nil {
+					return err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	if !haveHeader {
+		return errors.New("gif: assemble: missing header")
+	}
+
+	if err := enc.WriteTrailer(); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("gif: assemble: expected %v", d)
+	}
+	return nil
+}
+
+type dumpHeader struct {
+	Version         string   `json:"version"`
+	Width           int      `json:"width"`
+	Height          int      `json:"height"`
+	BackgroundIndex byte     `json:"backgroundIndex"`
+	AspectRatio     byte     `json:"aspectRatio,omitempty"`
+	Palette         []string `json:"palette,omitempty"`
+}
+
+func (dh *dumpHeader) writeText(w io.Writer) {
+	fmt.Fprintf(w, "header %s %dx%d background %d", dh.Version, dh.Width, dh.Height, dh.BackgroundIndex)
+	if dh.AspectRatio != 0 {
+		fmt.Fprintf(w, " aspect %d", dh.AspectRatio)
+	}
+	fmt.Fprintln(w)
+	if dh.Palette != nil {
+		fmt.Fprintf(w, "  palette %d: %s\n", len(dh.Palette), strings.Join(dh.Palette, " "))
+	}
+}
+
+// dumpBlock describes any block, with only the fields relevant to its type set.
+type dumpBlock struct {
+	Type string `json:"type"` // frame, plainText, comment, netscape, application or extension
+
+	// frame
+	Bounds           *[4]int  `json:"bounds,omitempty"`  // min x, min y, max x, max y
+	Palette          []string `json:"palette,omitempty"` // local color table
+	TransparentIndex *int     `json:"transparentIndex,omitempty"`
+	Interlaced       bool     `json:"interlaced,omitempty"`
+	Image            string   `json:"image,omitempty"`
+	Pixels           []string `json:"pixels,omitempty"`
+
+	// frame and plain text
+	Delay    int  `json:"delay,omitempty"` // 100ths of a second
+	Disposal byte `json:"disposal,omitempty"`
+
+	// plain text
+	Grid       *[4]int `json:"grid,omitempty"` // left, top, width, height
+	Cell       *[2]int `json:"cell,omitempty"` // width, height
+	Foreground byte    `json:"foreground,omitempty"`
+	Background byte    `json:"background,omitempty"`
+
+	// plain text and comment
+	Strings []string `json:"strings,omitempty"`
+
+	// netscape, application and extension
+	LoopCount  int      `json:"loopCount,omitempty"`
+	Identifier string   `json:"identifier,omitempty"`
+	Label      byte     `json:"label,omitempty"`
+	SubBlocks  []string `json:"subBlocks,omitempty"` // hex
+}
+
+func newDumpBlock(blk any, info *blockInfo, index int, opts *DumpOptions) (*dumpBlock, error) {
+	switch blk := blk.(type) {
+	case *Frame:
+		pm := blk.Image
+		db := &dumpBlock{
+			Type:       "frame",
+			Bounds:     &[4]int{pm.Rect.Min.X, pm.Rect.Min.Y, pm.Rect.Max.X, pm.Rect.Max.Y},
+			Interlaced: info.fields&fInterlace != 0,
+		}
+		if info.control {
+			db.Delay = int(blk.DelayTime / (10 * time.Millisecond))
+			db.Disposal = blk.DisposalMethod
+		}
+		// stored colors are opaque, and the decoder pads the palette with transparent entries
+		// up to an out of range transparent index, so it is the last transparent entry
+		for i := len(pm.Palette) - 1; i >= 0; i-- {
+			if _, _, _, a := pm.Palette[i].RGBA(); a == 0 {
+				ti := i
+				db.TransparentIndex = &ti
+				break
+			}
+		}
+		if info.fields&fColorTable != 0 {
+			n := 1 << (1 + uint(info.fields&fColorTableBitsMask))
+			db.Palette = dumpPalette(pm.Palette[:min(n, len(pm.Palette))])
+		}
+		if opts.Image != nil {
+			ref, err := opts.Image(index, pm)
+			if err != nil {
+				return nil, err
+			}
+			db.Image = ref
+		} else {
+			for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+				i := pm.PixOffset(pm.Rect.Min.X, y)
+				db.Pixels = append(db.Pixels, hex.EncodeToString(pm.Pix[i:i+pm.Rect.Dx()]))
+			}
+		}
+		return db, nil
+	case *PlainText:
+		db := &dumpBlock{
+			Type:       "plainText",
+			Grid:       &[4]int{int(blk.TextGridLeftPosition), int(blk.TextGridTopPosition), int(blk.TextGridWidth), int(blk.TextGridHeight)},
+			Cell:       &[2]int{int(blk.CharacterCellWidth), int(blk.CharacterCellHeight)},
+			Foreground: blk.TextForegroundColorIndex,
+			Background: blk.TextBackgroundColorIndex,
+			Strings:    blk.Strings,
+		}
+		if info.control {
+			db.Delay = int(blk.DelayTime / (10 * time.Millisecond))
+			db.Disposal = blk.DisposalMethod
+		}
+		return db, nil
+	case *Comment:
+		return &dumpBlock{Type: "comment", Strings: blk.Strings}, nil
+	case *ApplicationNetscape:
+		return &dumpBlock{Type: "netscape", LoopCount: blk.LoopCount, SubBlocks: dumpSubBlocks(blk.SubBlocks)}, nil
+	case *UnknownApplication:
+		return &dumpBlock{Type: "application", Identifier: blk.Identifier, SubBlocks: dumpSubBlocks(blk.SubBlocks)}, nil
+	case *UnknownExtension:
+		return &dumpBlock{Type: "extension", Label: blk.Label, SubBlocks: dumpSubBlocks(blk.SubBlocks)}, nil
+	}
+	return nil, fmt.Errorf("gif: dump: unexpected block %T", blk)
+}
+
+func (db *dumpBlock) writeText(w io.Writer) {
+	switch db.Type {
+	case "frame":
+		b := db.Bounds
+		fmt.Fprintf(w, "frame %dx%d at %d,%d delay %d disposal %d", b[2]-b[0], b[3]-b[1], b[0], b[1], db.Delay, db.Disposal)
+		if db.TransparentIndex != nil {
+			fmt.Fprintf(w, " transparent %d", *db.TransparentIndex)
+		}
+		if db.Interlaced {
+			fmt.Fprint(w, " interlaced")
+		}
+		fmt.Fprintln(w)
+		if db.Palette != nil {
+			fmt.Fprintf(w, "  palette %d: %s\n", len(db.Palette), strings.Join(db.Palette, " "))
+		}
+		if db.Image != "" {
+			fmt.Fprintf(w, "  image %s\n", db.Image)
+		}
+		for _, row := range db.Pixels {
+			fmt.Fprintf(w, "  %s\n", row)
+		}
+	case "plainText":
+		fmt.Fprintf(w, "plain text %dx%d at %d,%d cell %dx%d foreground %d background %d delay %d disposal %d\n",
+			db.Grid[2], db.Grid[3], db.Grid[0], db.Grid[1], db.Cell[0], db.Cell[1], db.Foreground, db.Background, db.Delay, db.Disposal)
+		for _, s := range db.Strings {
+			fmt.Fprintf(w, "  %q\n", s)
+		}
+	case "comment":
+		fmt.Fprintln(w, "comment")
+		for _, s := range db.Strings {
+			fmt.Fprintf(w, "  %q\n", s)
+		}
+	case "netscape":
+		fmt.Fprintf(w, "netscape loop %d\n", db.LoopCount)
+	case "application":
+		fmt.Fprintf(w, "application %q\n", db.Identifier)
+	case "extension":
+		fmt.Fprintf(w, "extension 0x%.2x\n", db.Label)
+	}
+	for _, sb := range db.SubBlocks {
+		fmt.Fprintf(w, "  sub-block %d: %s\n", len(sb)/2, sb)
+	}
+}
+
+func (db *dumpBlock) write(enc *Encoder, gp color.Palette, opts *AssembleOptions) error {
+	subBlocks, err := parseSubBlocks(db.SubBlocks)
+	if err != nil {
+		return err
+	}
+	delay := time.Duration(db.Delay) * 10 * time.Millisecond
+
+	switch db.Type {
+	case "frame":
+		f, err := db.frame(gp, opts)
+		if err != nil {
+			return err
+		}
+		f.DelayTime = delay
+		return enc.WriteFrame(f)
+	case "plainText":
+		if db.Grid == nil || db.Cell == nil {
+			return errors.New("gif: assemble: plain text missing grid or cell")
+		}
+		return enc.WritePlainText(&PlainText{
+			TextGridLeftPosition:     uint16(db.Grid[0]),
+			TextGridTopPosition:      uint16(db.Grid[1]),
+			TextGridWidth:            uint16(db.Grid[2]),
+			TextGridHeight:           uint16(db.Grid[3]),
+			CharacterCellWidth:       byte(db.Cell[0]),
+			CharacterCellHeight:      byte(db.Cell[1]),
+			TextForegroundColorIndex: db.Foreground,
+			TextBackgroundColorIndex: db.Background,
+			Strings:                  db.Strings,
+			DelayTime:                delay,
+			DisposalMethod:           db.Disposal,
+		})
+	case "comment":
+		return enc.WriteComment(&Comment{Strings: db.Strings})
+	case "netscape":
+		return enc.WriteApplicationNetscape(&ApplicationNetscape{LoopCount: db.LoopCount, SubBlocks: subBlocks})
+	case "application":
+		return enc.WriteUnknownApplication(&UnknownApplication{Identifier: db.Identifier, SubBlocks: subBlocks})
+	case "extension":
+		return enc.WriteUnknownExtension(&UnknownExtension{Label: db.Label, SubBlocks: subBlocks})
+	}
+	return fmt.Errorf("gif: assemble: unknown block type %q", db.Type)
+}
+
+func (db *dumpBlock) frame(gp color.Palette, opts *AssembleOptions) (*Frame, error) {
+	if db.Bounds == nil {
+		return nil, errors.New("gif: assemble: frame missing bounds")
+	}
+	p, err := parsePalette(db.Palette)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		if gp == nil {
+			return nil, errors.New("gif: assemble: frame has no color table")
+		}
+		p = gp
+	}
+	if ti := db.TransparentIndex; ti != nil {
+		if *ti < 0 || *ti > 0xff {
+			return nil, errors.New("gif: assemble: transparent index out of range")
+		}
+		// the decoder accepts an index beyond the palette, so extend it with the black entries
+		// the encoder pads color tables with, as the first transparent entry is the one written
+		p = append(color.Palette(nil), p...)
+		for len(p) <= *ti {
+			p = append(p, color.RGBA{A: 0xff})
+		}
+		p[*ti] = color.RGBA{}
+	}
+
+	b := db.Bounds
+	pm := image.NewPaletted(image.Rect(b[0], b[1], b[2], b[3]), p)
+	switch {
+	case db.Image != "":
+		if opts.Image == nil {
+			return nil, errors.New("gif: assemble: no loader for image " + db.Image)
+		}
+		m, err := opts.Image(db.Image)
+		if err != nil {
+			return nil, err
+		}
+		if m.Bounds().Size() != pm.Rect.Size() {
+			return nil, errors.New("gif: assemble: image size mismatch for " + db.Image)
+		}
+		src, paletted := m.(*image.Paletted)
+		mb := m.Bounds()
+		for y := 0; y < pm.Rect.Dy(); y++ {
+			for x := 0; x < pm.Rect.Dx(); x++ {
+				i := pm.PixOffset(pm.Rect.Min.X+x, pm.Rect.Min.Y+y)
+				if paletted {
+					pm.Pix[i] = src.ColorIndexAt(mb.Min.X+x, mb.Min.Y+y)
+				} else {
+					pm.Pix[i] = uint8(p.Index(m.At(mb.Min.X+x, mb.Min.Y+y)))
+				}
+			}
+		}
+	default:
+		if len(db.Pixels) != pm.Rect.Dy() {
+			return nil, errors.New("gif: assemble: pixel row count mismatch")
+		}
+		for y, row := range db.Pixels {
+			pix, err := hex.DecodeString(row)
+			if err != nil {
+				return nil, fmt.Errorf("gif: assemble: %v", err)
+			}
+			if len(pix) != pm.Rect.Dx() {
+				return nil, errors.New("gif: assemble: pixel row length mismatch")
+			}
+			copy(pm.Pix[y*pm.Stride:], pix)
+		}
+	}
+	return &Frame{Image: pm, DisposalMethod: db.Disposal}, nil
+}
+
+func dumpPalette(p color.Palette) []string {
+	if len(p) == 0 {
+		return nil
+	}
+	strs := make([]string, len(p))
+	for i, c := range p {
+		r, g, b, _ := c.RGBA()
+		strs[i] = fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+	}
+	return strs
+}
+
+func parsePalette(strs []string) (color.Palette, error) {
+	if len(strs) == 0 {
+		return nil, nil
+	}
+	if len(strs) > 256 {
+		return nil, errors.New("gif: assemble: too many palette entries")
+	}
+	p := make(color.Palette, len(strs))
+	for i, s := range strs {
+		var b []byte
+		if len(s) == 7 && s[0] == '#' {
+			b, _ = hex.DecodeString(s[1:])
+		}
+		if len(b) != 3 {
+			return nil, fmt.Errorf("gif: assemble: invalid color %q", s)
+		}
+		p[i] = color.RGBA{R: b[0], G: b[1], B: b[2], A: 0xff}
+	}
+	return p, nil
+}
+
+func dumpSubBlocks(subBlocks [][]byte) []string {
+	var strs []string
+	for _, sb := range subBlocks {
+		strs = append(strs, hex.EncodeToString(sb))
+	}
+	return strs
+}
+
+func parseSubBlocks(strs []string) ([][]byte, error) {
+	var subBlocks [][]byte
+	for _, s := range strs {
+		sb, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("gif: assemble: %v", err)
+		}
+		subBlocks = append(subBlocks, sb)
+	}
+	return subBlocks, nil
+}
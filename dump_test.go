@@ -0,0 +1,181 @@
+package gif
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpAssemble(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	gp := color.Palette{black, white, red, black}
+	lp := color.Palette{red, color.RGBA{}}
+	f0 := image.NewPaletted(image.Rect(0, 0, 3, 2), gp)
+	copy(f0.Pix, []uint8{0, 1, 2, 2, 1, 0})
+	tp := append(color.Palette(nil), gp...)
+	tp[3] = color.RGBA{}
+	f1 := image.NewPaletted(image.Rect(1, 1, 3, 2), tp)
+	copy(f1.Pix, []uint8{3, 1})
+	f2 := image.NewPaletted(image.Rect(0, 0, 1, 1), lp)
+	f2.Pix[0] = 1
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	writes := []error{
+		enc.WriteHeaderFrom(&Header{Version: version89a, Config: image.Config{Width: 3, Height: 2, ColorModel: gp}, BackgroundIndex: 1}),
+		enc.WriteApplicationNetscape(&ApplicationNetscape{LoopCount: 3, SubBlocks: [][]byte{{1, 2}}}),
+		enc.WriteComment(&Comment{Strings: []string{"hello", "world"}}),
+		enc.WriteFrame(&Frame{Image: f0, DelayTime: 50 * time.Millisecond, DisposalMethod: DisposalNone}),
+		enc.WriteFrame(&Frame{Image: f1, DelayTime: 70 * time.Millisecond, DisposalMethod: DisposalBackground}),
+		enc.WritePlainText(&PlainText{TextGridWidth: 3, TextGridHeight: 2, CharacterCellWidth: 1, CharacterCellHeight: 2, TextForegroundColorIndex: 1, Strings: []string{"hi"}}),
+		enc.WriteUnknownApplication(&UnknownApplication{Identifier: "ABCDEFGH123", SubBlocks: [][]byte{{0xff}}}),
+		enc.WriteUnknownExtension(&UnknownExtension{Label: 0x42, SubBlocks: [][]byte{{0}, {1, 2, 3}}}),
+		enc.WriteFrame(&Frame{Image: f2}),
+		enc.WriteTrailer(),
+		enc.Flush(),
+	}
+	for i, err := range writes {
+		if err != nil {
+			t.Fatal("write", i, err)
+		}
+	}
+	data := buf.Bytes()
+
+	text := &bytes.Buffer{}
+	if err := Dump(text, NewDecoder(bytes.NewReader(data)), nil); err != nil {
+		t.Fatal("Dump:", err)
+	}
+	for _, want := range []string{
+		"header GIF89a 3x2 background 1\n  palette 4: #000000 #ffffff #ff0000 #000000\n",
+		"netscape loop 3\n  sub-block 2: 0102\n",
+		"comment\n  \"hello\"\n  \"world\"\n",
+		"frame 3x2 at 0,0 delay 5 disposal 1\n  000102\n  020100\n",
+		"frame 2x1 at 1,1 delay 7 disposal 2 transparent 3\n  0301\n",
+		"plain text 3x2 at 0,0 cell 1x2 foreground 1 background 0 delay 0 disposal 0\n  \"hi\"\n",
+		"application \"ABCDEFGH123\"\n  sub-block 1: ff\n",
+		"extension 0x42\n  sub-block 1: 00\n  sub-block 3: 010203\n",
+		"frame 1x1 at 0,0 delay 0 disposal 0 transparent 1\n  palette 2: #ff0000 #000000\n  01\n",
+		"trailer\n",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Fatalf("dump missing %q in:\n%s", want, text)
+		}
+	}
+
+	testCases := []struct {
+		name string
+		png  bool
+	}{
+		{"hex", false},
+		{"png", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := make(map[string][]byte)
+			dopts := &DumpOptions{JSON: true}
+			aopts := &AssembleOptions{}
+			if tc.png {
+				dopts.Image = func(i int, pm *image.Paletted) (string, error) {
+					buf := &bytes.Buffer{}
+					err := png.Encode(buf, pm)
+					name := fmt.Sprintf("frame%d.png", i)
+					files[name] = buf.Bytes()
+					return name, err
+				}
+				aopts.Image = func(ref string) (image.Image, error) {
+					return png.Decode(bytes.NewReader(files[ref]))
+				}
+			}
+
+			js := &bytes.Buffer{}
+			if err := Dump(js, NewDecoder(bytes.NewReader(data)), dopts); err != nil {
+				t.Fatal("Dump:", err)
+			}
+			if tc.png != (len(files) == 3) {
+				t.Fatal("unexpected image files:", len(files))
+			}
+
+			out := &bytes.Buffer{}
+			if err := Assemble(NewEncoder(out), bytes.NewReader(js.Bytes()), aopts); err != nil {
+				t.Fatal("Assemble:", err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Fatalf("assembled GIF differs:\n got: %x\nwant: %x", out.Bytes(), data)
+			}
+		})
+	}
+}
+
+func TestDumpStored(t *testing.T) {
+	gp := color.Palette{black, white}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	f0 := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{white, black})
+	f1 := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{black, white, color.RGBA{}})
+	f1.Pix[1] = 2
+	writes := []error{
+		enc.WriteHeaderFrom(&Header{Version: version89a, Config: image.Config{Width: 2, Height: 1, ColorModel: gp}}),
+		enc.WriteFrame(&Frame{Image: f0, DisposalMethod: DisposalBackground}),
+		enc.WriteFrame(&Frame{Image: f1}),
+		enc.WriteTrailer(),
+		enc.Flush(),
+	}
+	for i, err := range writes {
+		if err != nil {
+			t.Fatal("write", i, err)
+		}
+	}
+	data := buf.Bytes()
+	// make the first local table match the global one, and interlace the single row
+	i := bytes.Index(data, []byte{0xff, 0xff, 0xff, 0, 0, 0})
+	copy(data[i:], []byte{0, 0, 0, 0xff, 0xff, 0xff})
+	data[i-1] |= fInterlace
+	// move the second frame's transparent index past the end of its color table
+	j := bytes.LastIndex(data, []byte{0x21, 0xf9, 0x04})
+	data[j+6] = 5
+
+	text := &bytes.Buffer{}
+	if err := Dump(text, NewDecoder(bytes.NewReader(data)), nil); err != nil {
+		t.Fatal("Dump:", err)
+	}
+	for _, want := range []string{
+		"frame 2x1 at 0,0 delay 0 disposal 2 interlaced\n  palette 2: #000000 #ffffff\n",
+		"frame 2x1 at 0,0 delay 0 disposal 0 transparent 5\n  palette 4: #000000 #ffffff #000000 #000000\n",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Fatalf("dump missing %q in:\n%s", want, text)
+		}
+	}
+
+	js := &bytes.Buffer{}
+	if err := Dump(js, NewDecoder(bytes.NewReader(data)), &DumpOptions{JSON: true}); err != nil {
+		t.Fatal("Dump:", err)
+	}
+	out := &bytes.Buffer{}
+	if err := Assemble(NewEncoder(out), bytes.NewReader(js.Bytes()), nil); err != nil {
+		t.Fatal("Assemble:", err)
+	}
+	want, err := DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	got, err := DecodeAll(out)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	for i, pm := range want.Image {
+		// only the stored entries and the transparent index are preserved
+		if !reflect.DeepEqual(got.Image[i].Pix, pm.Pix) || !palettesEqual(got.Image[i].Palette[:min(len(pm.Palette), 4)], pm.Palette[:min(len(pm.Palette), 4)]) {
+			t.Fatal("frame", i, "differs after round trip:", got.Image[i].Palette, pm.Palette)
+		}
+	}
+	if _, _, _, a := got.Image[1].Palette[5].RGBA(); a != 0 {
+		t.Fatal("transparent index not preserved:", got.Image[1].Palette)
+	}
+}
@@ -24,6 +24,52 @@ func NewEncoder(w io.Writer) *Encoder {
 
 type Encoder = encoder
 
+const (
+	version87a = "GIF87a"
+	version89a = "GIF89a"
+)
+
+// encoderState holds the state of the block writing methods. Since Encoder is the forked
+// encoder, it's carried by a writer in front of the output, installed by Encoder.state.
+type encoderState struct {
+	writer                       // Output, possibly wrapped by a progressWriter or contextWriter.
+	version     string           // Version given to WriteHeaderFrom, empty if selected automatically.
+	holding     bool             // Header held back until the GIF version can be determined.
+	header      []byte           // Header bytes held back.
+	deferred    *deferredHeader  // Blocks held back until the global color table is chosen.
+	globalKeys  map[uint32]uint8 // Global color table indexes that frames are remapped onto.
+	headerKeys  map[uint32]uint8 // Global color table indexes for WriteImageFrame, built on first use.
+	textPalette color.Palette    // Global color table that plain text color indexes refer to, if replaced.
+	remapped    image.Paletted   // Storage reused for frames remapped onto the global color table.
+	progress    *progressWriter  // Byte counter and callback installed by SetProgress.
+}
+
+// state returns the encoder's state, installing it in front of the output on first use.
+func (e *Encoder) state() *encoderState {
+	if s, ok := e.w.(*encoderState); ok {
+		return s
+	}
+	s := &encoderState{writer: e.w}
+	e.w = s
+	return s
+}
+
+func (s *encoderState) Write(p []byte) (int, error) {
+	if s.holding {
+		s.header = append(s.header, p...)
+		return len(p), nil
+	}
+	return s.writer.Write(p)
+}
+
+func (s *encoderState) WriteByte(c byte) error {
+	if s.holding {
+		s.header = append(s.header, c)
+		return nil
+	}
+	return s.writer.WriteByte(c)
+}
+
 func (e *Encoder) Encode(g *GIF) error {
 	if len(g.Image) == 0 {
 		return errors.New("gif: must provide at least one image")
@@ -41,7 +87,11 @@ func (e *Encoder) Encode(g *GIF) error {
 		g.Config.Height = p.Y
 	}
 
-	if err := e.WriteHeader(g.Config, g.BackgroundIndex); err != nil {
+	vers := version87a
+	if usesExtensions(g) {
+		vers = version89a
+	}
+	if err := e.WriteHeaderFrom(&Header{Version: vers, Config: g.Config, BackgroundIndex: g.BackgroundIndex}); err != nil {
 		return err
 	}
 	if len(g.Image) > 1 && g.LoopCount >= 0 {
@@ -65,33 +115,62 @@ func (e *Encoder) Encode(g *GIF) error {
 	return e.Flush()
 }
 
-type option func(*Options)
+func usesExtensions(g *GIF) bool {
+	if len(g.Image) > 1 && g.LoopCount >= 0 {
+		return true
+	}
+	for i, pm := range g.Image {
+		if g.Delay[i] > 0 || (g.Disposal != nil && g.Disposal[i] != 0) || hasTransparent(pm.Palette) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTransparent(p color.Palette) bool {
+	return findTransparent(p) >= 0
+}
+
+type encodeOptions struct {
+	Options
+	globalPalette    bool
+	transparent      bool
+	transparentIndex int // -1 for the last palette entry
+	alphaThreshold   int // -1 for half opacity
+	alphaDither      bool
+	matte            color.Color
+}
+
+type option func(*encodeOptions)
 
 func WithNumColors(n int) option {
-	return func(o *Options) {
+	return func(o *encodeOptions) {
 		o.NumColors = n
 	}
 }
 
 func WithQuantizer(q draw.Quantizer) option {
-	return func(o *Options) {
+	return func(o *encodeOptions) {
 		o.Quantizer = q
 	}
 }
 
 func WithDrawer(d draw.Drawer) option {
-	return func(o *Options) {
+	return func(o *encodeOptions) {
 		o.Drawer = d
 	}
 }
 
-func (e *Encoder) EncodeImage(m image.Image, o ...option) error {
-	b := m.Bounds()
-	if b.Dx() > math.MaxUint16 || b.Dy() > math.MaxUint16 {
-		return errors.New("gif: image is too large to encode")
+// WithGlobalPalette maps frames onto the global color table when it contains every color
+// used, avoiding the need for a local color table.
+func WithGlobalPalette() option {
+	return func(o *encodeOptions) {
+		o.globalPalette = true
 	}
+}
 
-	opts := &Options{}
+func newEncodeOptions(o []option) *encodeOptions {
+	opts := &encodeOptions{transparentIndex: -1, alphaThreshold: -1}
 	for _, o := range o {
 		o(opts)
 	}
@@ -101,7 +180,59 @@ func (e *Encoder) EncodeImage(m image.Image, o ...option) error {
 	if opts.Drawer == nil {
 		opts.Drawer = draw.FloydSteinberg
 	}
+	if opts.transparent && opts.NumColors < 2 {
+		opts.NumColors = 2
+	}
+	if opts.alphaThreshold < 0 {
+		opts.alphaThreshold = 0x80
+	}
+	return opts
+}
+
+func (e *Encoder) EncodeImage(m image.Image, o ...option) error {
+	b := m.Bounds()
+	if b.Dx() > math.MaxUint16 || b.Dy() > math.MaxUint16 {
+		return errors.New("gif: image is too large to encode")
+	}
+
+	pm := toPaletted(m, newEncodeOptions(o))
+	if pm.Rect.Min != (image.Point{}) {
+		dup := *pm
+		dup.Rect = dup.Rect.Sub(dup.Rect.Min)
+		pm = &dup
+	}
+
+	return e.Encode(&GIF{
+		Image: []*image.Paletted{pm},
+		Delay: []int{0},
+		Config: image.Config{
+			ColorModel: pm.Palette,
+			Width:      b.Dx(),
+			Height:     b.Dy(),
+		},
+	})
+}
+
+func (e *Encoder) WriteImageFrame(m image.Image, delay time.Duration, o ...option) error {
+	b := m.Bounds()
+	if b.Dx() > math.MaxUint16 || b.Dy() > math.MaxUint16 {
+		return errors.New("gif: image is too large to encode")
+	}
+
+	opts := newEncodeOptions(o)
+	var pm *image.Paletted
+	if opts.globalPalette {
+		pm = e.toGlobalPaletted(m)
+	}
+	if pm == nil {
+		pm = toPaletted(m, opts)
+	}
+
+	return e.WriteFrame(&Frame{Image: pm, DelayTime: delay})
+}
 
+func toPaletted(m image.Image, opts *encodeOptions) *image.Paletted {
+	b := m.Bounds()
 	pm, _ := m.(*image.Paletted)
 	if pm == nil {
 		if cp, ok := m.ColorModel().(color.Palette); ok {
@@ -113,41 +244,164 @@ func (e *Encoder) EncodeImage(m image.Image, o ...option) error {
 			}
 		}
 	}
-	if pm == nil || len(pm.Palette) > opts.NumColors {
+	if pm != nil && len(pm.Palette) <= opts.NumColors && (opts.transparent || opts.matte != nil) {
+		// paletted input keeps its colors unless there's no room for a transparent entry
+		if am := palettedAlpha(pm, opts); am != nil {
+			return am
+		}
+		pm = nil
+	}
+	if (pm == nil || len(pm.Palette) > opts.NumColors) && (opts.transparent || opts.matte != nil) {
+		pm = toPalettedAlpha(m, opts)
+	} else if pm == nil || len(pm.Palette) > opts.NumColors {
 		pm = image.NewPaletted(b, palette.Plan9[:opts.NumColors])
 		if opts.Quantizer != nil {
 			pm.Palette = opts.Quantizer.Quantize(make(color.Palette, 0, opts.NumColors), m)
 		}
 		opts.Drawer.Draw(pm, b, m, b.Min)
 	}
+	return pm
+}
 
-	if pm.Rect.Min != (image.Point{}) {
-		dup := *pm
-		dup.Rect = dup.Rect.Sub(dup.Rect.Min)
-		pm = &dup
+// toGlobalPaletted returns m mapped onto the global color table, or nil if any color is missing
+// or partially transparent. The result is only valid until the next frame is written.
+func (e *Encoder) toGlobalPaletted(m image.Image) *image.Paletted {
+	gp, ok := e.g.Config.ColorModel.(color.Palette)
+	if !ok || len(gp) == 0 {
+		return nil
+	}
+	s := e.state()
+	keys := s.globalKeys
+	if keys == nil {
+		if s.headerKeys == nil {
+			s.headerKeys = paletteKeys(gp)
+		}
+		keys = s.headerKeys
+	}
+
+	if pm, ok := m.(*image.Paletted); ok {
+		return remapInto(&s.remapped, pm, gp, keys)
+	}
+
+	r := m.Bounds()
+	pm := &s.remapped
+	if n := r.Dx() * r.Dy(); cap(pm.Pix) < n {
+		pm.Pix = make([]uint8, n)
+	} else {
+		pm.Pix = pm.Pix[:n]
+	}
+	pm.Stride = r.Dx()
+	pm.Rect = r
+	pm.Palette = gp
+	i := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r, g, b, a := m.At(x, y).RGBA()
+			key := uint32(transparentKey)
+			if a == 0xffff {
+				key = r>>8<<16 | g>>8<<8 | b>>8
+			} else if a != 0 {
+				return nil
+			}
+			c, ok := keys[key]
+			if !ok {
+				return nil
+			}
+			pm.Pix[i] = c
+			i++
+		}
 	}
-
-	return e.Encode(&GIF{
-		Image: []*image.Paletted{pm},
-		Delay: []int{0},
-		Config: image.Config{
-			ColorModel: pm.Palette,
-			Width:      b.Dx(),
-			Height:     b.Dy(),
-		},
-	})
+	return pm
 }
 
 func (e *Encoder) WriteHeader(cfg image.Config, backgroundIndex byte) error {
-	if cfg.ColorModel != nil {
-		if _, ok := cfg.ColorModel.(color.Palette); !ok {
+	return e.WriteHeaderFrom(&Header{Version: version89a, Config: cfg, BackgroundIndex: backgroundIndex})
+}
+
+// WriteHeaderFrom writes the given header, typically one returned by Decoder.ReadHeader.
+// An empty version selects GIF89a if the first block written next needs it, and GIF87a
+// otherwise, so the header is held in memory until then. Blocks needing GIF89a that follow
+// an automatically selected GIF87a header are still written, as decoders accept them, but
+// they fail with an error when GIF87a is requested explicitly.
+func (e *Encoder) WriteHeaderFrom(hdr *Header) error {
+	if hdr.Config.ColorModel != nil {
+		if _, ok := hdr.Config.ColorModel.(color.Palette); !ok {
 			return errors.New("gif: color model must be a color.Palette")
 		}
 	}
 
-	e.g.Config = cfg
-	e.g.BackgroundIndex = backgroundIndex
-	e.writeHeader()
+	vers := hdr.Version
+	switch vers {
+	case "", version87a, version89a:
+	default:
+		return fmt.Errorf("gif: unsupported version %q", vers)
+	}
+
+	s := e.state()
+	s.version = vers
+	s.holding = vers == ""
+	s.header = s.header[:0]
+	s.globalKeys = nil
+	s.headerKeys = nil
+	s.textPalette = nil
+	e.g.Config = hdr.Config
+	e.g.BackgroundIndex = hdr.BackgroundIndex
+	if vers == "" {
+		vers = version87a
+	}
+	e.writeHeader_(vers, hdr.AspectRatio)
+	return e.err
+}
+
+func (e *Encoder) writeHeader_(vers string, aspectRatio byte) {
+	if e.err != nil {
+		return
+	}
+	if _, e.err = io.WriteString(e.w, vers); e.err != nil {
+		return
+	}
+
+	lePutUint16(e.buf[0:2], uint16(e.g.Config.Width))
+	lePutUint16(e.buf[2:4], uint16(e.g.Config.Height))
+	e.write(e.buf[:4])
+
+	if p, ok := e.g.Config.ColorModel.(color.Palette); ok && len(p) > 0 {
+		paddedSize := log2(len(p))
+		e.buf[0] = fColorTable | uint8(paddedSize)
+		e.buf[1] = e.g.BackgroundIndex
+		e.buf[2] = aspectRatio
+		e.write(e.buf[:3])
+		var err error
+		if e.globalCT, err = encodeColorTable(e.globalColorTable[:], p, paddedSize); err != nil {
+			if e.err == nil {
+				e.err = err
+			}
+			return
+		}
+		e.write(e.globalColorTable[:e.globalCT])
+	} else {
+		e.buf[0] = 0x00
+		e.buf[1] = 0x00
+		e.buf[2] = aspectRatio
+		e.write(e.buf[:3])
+	}
+}
+
+// resolveVersion writes any header held back by an automatically selected version, using
+// GIF89a if the block about to be written needs it. It fails if the block needs GIF89a but
+// GIF87a was requested.
+func (e *Encoder) resolveVersion(needs89a bool) error {
+	s := e.state()
+	if s.holding {
+		s.holding = false
+		if needs89a {
+			copy(s.header, version89a)
+		}
+		e.write(s.header)
+		s.header = s.header[:0]
+	} else if needs89a && s.version == version87a {
+		return errors.New("gif: block requires GIF89a")
+	}
 	return e.err
 }
 
@@ -155,7 +409,17 @@ func (e *Encoder) WritePlainText(pt *PlainText) error {
 	if err := validateStrings(pt.Strings); err != nil {
 		return fmt.Errorf("gif: plain text %v", err)
 	}
+	if e.state().deferred != nil {
+		return e.deferBlock(pt)
+	}
+	pt, err := e.remapPlainText(pt)
+	if err != nil {
+		return err
+	}
 
+	if err := e.resolveVersion(true); err != nil {
+		return err
+	}
 	if pt.DelayTime > 0 || pt.DisposalMethod != 0 {
 		e.buf[0] = sExtension
 		e.buf[1] = eGraphicControl
@@ -189,7 +453,13 @@ func (e *Encoder) WriteComment(c *Comment) error {
 	if err := validateStrings(c.Strings); err != nil {
 		return fmt.Errorf("gif: comment %v", err)
 	}
+	if e.state().deferred != nil {
+		return e.deferBlock(c)
+	}
 
+	if err := e.resolveVersion(true); err != nil {
+		return err
+	}
 	e.buf[0] = sExtension
 	e.buf[1] = eComment
 	if e.write(e.buf[:2]); e.err != nil {
@@ -230,7 +500,13 @@ func (e *Encoder) WriteApplicationNetscape(an *ApplicationNetscape) error {
 	if err := validateSubBlocks(an.SubBlocks); err != nil {
 		return fmt.Errorf("gif: application %v", err)
 	}
+	if e.state().deferred != nil {
+		return e.deferBlock(an)
+	}
 
+	if err := e.resolveVersion(true); err != nil {
+		return err
+	}
 	e.buf[0] = sExtension
 	e.buf[1] = eApplication
 	e.buf[2] = 0x0b
@@ -258,7 +534,13 @@ func (e *Encoder) WriteUnknownApplication(ua *UnknownApplication) error {
 	if err := validateSubBlocks(ua.SubBlocks); err != nil {
 		return fmt.Errorf("gif: application %v", err)
 	}
+	if e.state().deferred != nil {
+		return e.deferBlock(ua)
+	}
 
+	if err := e.resolveVersion(true); err != nil {
+		return err
+	}
 	e.buf[0] = sExtension
 	e.buf[1] = eApplication
 	e.buf[2] = byte(len(ua.Identifier))
@@ -276,7 +558,7 @@ func validateString(str string) error {
 	if len(str) > 0xff {
 		return errors.New("string too long")
 	}
-	for c := range str {
+	for _, c := range str {
 		if c > unicode.MaxASCII {
 			return errors.New("string must only contain ASCII characters")
 		}
@@ -289,7 +571,13 @@ func (e *Encoder) WriteUnknownExtension(ue *UnknownExtension) error {
 	if err := validateSubBlocks(ue.SubBlocks); err != nil {
 		return fmt.Errorf("gif: extension %v", err)
 	}
+	if e.state().deferred != nil {
+		return e.deferBlock(ue)
+	}
 
+	if err := e.resolveVersion(true); err != nil {
+		return err
+	}
 	e.buf[0] = sExtension
 	e.buf[1] = ue.Label
 	if e.write(e.buf[:2]); e.err != nil {
@@ -324,12 +612,34 @@ func (e *Encoder) writeSubBlocks(subBlocks [][]byte) error {
 }
 
 func (e *Encoder) WriteFrame(f *Frame) error {
-	e.writeImageBlock(f.Image, int(f.DelayTime/(10*time.Millisecond)), f.DisposalMethod)
+	if e.state().deferred != nil {
+		return e.deferBlock(f)
+	}
+	pm := f.Image
+	if s := e.state(); s.globalKeys != nil {
+		if remapped := remapInto(&s.remapped, pm, e.g.Config.ColorModel.(color.Palette), s.globalKeys); remapped != nil && remapCheaper(pm, remapped) {
+			pm = remapped
+		}
+	}
+	if err := e.resolveVersion(f.DelayTime >= 10*time.Millisecond || f.DisposalMethod != 0 || hasTransparent(pm.Palette)); err != nil {
+		return err
+	}
+	e.writeImageBlock(pm, int(f.DelayTime/(10*time.Millisecond)), f.DisposalMethod)
+	e.reportProgress(true)
 	return e.err
 }
 
 func (e *Encoder) WriteTrailer() error {
+	if e.state().deferred != nil {
+		if err := e.resolveDeferred(); err != nil {
+			return err
+		}
+	}
+	if err := e.resolveVersion(false); err != nil {
+		return err
+	}
 	e.writeByte(sTrailer)
+	e.reportProgress(false)
 	return e.err
 }
 
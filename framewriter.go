@@ -0,0 +1,213 @@
+package gif
+
+import (
+	"context"
+	"image"
+	"image/color"
+)
+
+// frameOptimizer converts full logical screen frames, as returned by Coalescer, into frames
+// that only store the pixels that changed since the previous frame. Consecutive frames are only
+// optimized against each other when they share the same palette and the earlier frame is not
+// disposed. Palettes without a transparent entry are extended with one where possible.
+type frameOptimizer struct {
+	o     *Optimizer
+	prev  *Frame // previous full frame
+	dirty bool   // whether anything may be showing on the logical screen
+
+	// The palette most recently extended with a transparent entry, and the result, so that
+	// consecutive frames with the same colors share one extended palette.
+	src, ext color.Palette
+}
+
+// transparent returns the given palette, extended with a transparent entry if necessary, along
+// with the index of that entry, or -1 if the palette is full.
+func (fo *frameOptimizer) transparent(p color.Palette) (color.Palette, int) {
+	if ti := findTransparent(p); ti >= 0 {
+		return p, ti
+	}
+	if len(p) == 0 || len(p) >= 256 {
+		return p, -1
+	}
+	// compare colors rather than storage, since callers may reuse palettes
+	if fo.ext == nil || !samePalette(fo.src, p) {
+		fo.src = append(fo.src[:0], p...)
+		fo.ext = append(p[:len(p):len(p)], color.Transparent)
+	}
+	return fo.ext, len(p)
+}
+
+// optimize returns the frame to write in place of the given full frame, whose disposal method
+// must be final. The palette of the given image may be replaced with an extended one, and its
+// pixels are overwritten with the transparent index where unchanged.
+func (fo *frameOptimizer) optimize(f *Frame) *Frame {
+	p, ti := fo.transparent(f.Image.Palette)
+	f.Image.Palette = p
+	out := &Frame{Image: f.Image, DelayTime: f.DelayTime, DisposalMethod: f.DisposalMethod}
+	if ti < 0 || fo.prev == nil || fo.prev.DisposalMethod != DisposalNone || !samePalette(fo.prev.Image.Palette, p) {
+		fo.o = nil
+	}
+	if ti >= 0 && f.DisposalMethod == DisposalNone {
+		// disposed frames must cover the whole logical screen
+		if fo.o == nil {
+			fo.o = NewOptimizer(uint8(ti))
+		}
+		if pm, err := fo.o.Optimize(f.Image); err == nil {
+			out.Image = pm
+		} else {
+			fo.o = nil
+		}
+	}
+	if ti >= 0 && !fo.dirty && out.Image == f.Image {
+		// nothing is showing through, so transparent borders can be dropped
+		crop := opaqueBounds(f.Image, uint8(ti))
+		if crop.Empty() {
+			crop = image.Rect(f.Image.Rect.Min.X, f.Image.Rect.Min.Y, f.Image.Rect.Min.X+1, f.Image.Rect.Min.Y+1)
+		}
+		out.Image = f.Image.SubImage(crop).(*image.Paletted)
+	}
+	if f.DisposalMethod == DisposalBackground {
+		fo.dirty = fo.dirty && !out.Image.Rect.Eq(f.Image.Rect)
+	} else {
+		fo.dirty = true
+	}
+	fo.prev = f
+	return out
+}
+
+// frameWriter writes full logical screen frames, as returned by Coalescer, to an encoder,
+// optionally optimized. Each frame passed to frame is held back until the next one arrives,
+// since the Coalescer may still change its disposal method, and any other blocks are held with
+// it to keep their order.
+type frameWriter struct {
+	enc    *Encoder
+	fo     *frameOptimizer // nil to write frames unchanged
+	held   *Frame
+	blocks []any // blocks that followed held
+}
+
+func newFrameWriter(enc *Encoder, optimize bool) *frameWriter {
+	w := &frameWriter{enc: enc}
+	if optimize {
+		w.fo = &frameOptimizer{}
+	}
+	return w
+}
+
+// frame writes the previously held frame and holds the given one.
+func (w *frameWriter) frame(ctx context.Context, f *Frame) error {
+	if err := w.flush(ctx); err != nil {
+		return err
+	}
+	w.held = f
+	return nil
+}
+
+// block writes any other block once the held frame has been written.
+func (w *frameWriter) block(blk any) error {
+	if w.held == nil {
+		return writeBlock(w.enc, blk)
+	}
+	w.blocks = append(w.blocks, blk)
+	return nil
+}
+
+// flush writes the held frame followed by any held blocks.
+func (w *frameWriter) flush(ctx context.Context) error {
+	if w.held == nil {
+		return nil
+	}
+	f := w.held
+	w.held = nil
+	if err := w.write(ctx, f); err != nil {
+		return err
+	}
+	blocks := w.blocks
+	w.blocks = nil
+	for _, blk := range blocks {
+		if err := writeBlock(w.enc, blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the given frame at once, whose disposal method must be final.
+func (w *frameWriter) write(ctx context.Context, f *Frame) error {
+	if w.fo != nil {
+		f = w.fo.optimize(f)
+	}
+	return w.enc.WriteFrameContext(ctx, f)
+}
+
+// writeBlock writes any block other than a frame.
+func writeBlock(enc *Encoder, blk any) error {
+	switch blk := blk.(type) {
+	case *PlainText:
+		return enc.WritePlainText(blk)
+	case *Comment:
+		return enc.WriteComment(blk)
+	case *ApplicationNetscape:
+		return enc.WriteApplicationNetscape(blk)
+	case *UnknownApplication:
+		return enc.WriteUnknownApplication(blk)
+	case *UnknownExtension:
+		return enc.WriteUnknownExtension(blk)
+	}
+	return nil
+}
+
+// findTransparent returns the index of the first transparent palette entry, or -1 if none.
+func findTransparent(p color.Palette) int {
+	for i, c := range p {
+		if c != nil {
+			if _, _, _, a := c.RGBA(); a == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// withTransparent returns p and the index of a transparent entry, appending one if necessary.
+// A full palette is copied with the entry closest to another entry replaced, so that pixels
+// mapped by nearest color lose as little as possible.
+func withTransparent(p color.Palette) (color.Palette, int) {
+	if i := findTransparent(p); i >= 0 {
+		return p, i
+	}
+	if len(p) < 256 {
+		return append(p[:len(p):len(p)], color.Transparent), len(p)
+	}
+	rgba := make([]color.RGBA, len(p))
+	for i, c := range p {
+		rgba[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	ti, best := 0, -1.0
+	for i := range rgba {
+		for j := i + 1; j < len(rgba); j++ {
+			if d := sqDiff(rgba[i], rgba[j]); best < 0 || d < best {
+				ti, best = j, d
+			}
+		}
+	}
+	q := append(color.Palette(nil), p...)
+	q[ti] = color.Transparent
+	return q, ti
+}
+
+// samePalette reports whether the palettes are identical.
+func samePalette(p0, p1 color.Palette) bool {
+	if len(p0) != len(p1) {
+		return false
+	}
+	if len(p0) > 0 && &p0[0] == &p1[0] {
+		return true
+	}
+	for i := range p0 {
+		if p0[i] != p1[i] {
+			return false
+		}
+	}
+	return true
+}
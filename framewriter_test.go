@@ -0,0 +1,113 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFrameOptimizerTransparent(t *testing.T) {
+	fo := &frameOptimizer{}
+	p := color.Palette{black, white}
+	ep, ti := fo.transparent(p)
+	if ti != 2 || len(ep) != 3 || len(p) != 2 {
+		t.Fatal("unexpected extension:", ep, ti)
+	}
+	if ep2, _ := fo.transparent(color.Palette{black, white}); &ep2[0] != &ep[0] {
+		t.Fatal("equal colors not shared")
+	}
+
+	// reused storage with new colors isn't mistaken for the cached palette
+	p[1] = color.RGBA{R: 0xff, A: 0xff}
+	if ep2, _ := fo.transparent(p); ep2[1] != p[1] || &ep2[0] == &ep[0] {
+		t.Fatal("stale extension:", ep2)
+	}
+	// only the current palette is kept
+	if len(fo.src) != 2 || fo.src[1] != p[1] {
+		t.Fatal("unexpected cache:", fo.src)
+	}
+
+	full := make(color.Palette, 256)
+	for i := range full {
+		full[i] = color.Gray{Y: uint8(i)}
+	}
+	if _, ti := fo.transparent(full); ti != -1 {
+		t.Fatal("full palette extended")
+	}
+}
+
+func TestOptimizeStream(t *testing.T) {
+	p := color.Palette{black, white}
+	g := &GIF{Config: image.Config{Width: 4, Height: 4, ColorModel: p}}
+	for i := 0; i < 3; i++ {
+		pm := image.NewPaletted(image.Rect(0, 0, 4, 4), p)
+		pm.Pix[5*i] = 1
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, 10)
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeader(g.Config, 0); err != nil {
+		t.Fatal("WriteHeader:", err)
+	}
+	for i, pm := range g.Image {
+		if err := enc.WriteFrame(&Frame{Image: pm, DelayTime: 100 * time.Millisecond}); err != nil {
+			t.Fatal("WriteFrame:", err)
+		}
+		if i == 0 {
+			if err := enc.WriteComment(&Comment{Strings: []string{"hi"}}); err != nil {
+				t.Fatal("WriteComment:", err)
+			}
+		}
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := OptimizeStream(NewEncoder(out), NewDecoder(buf)); err != nil {
+		t.Fatal("OptimizeStream:", err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(out.Bytes()))
+	if _, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	var blocks []string
+	for {
+		blk, err := dec.ReadBlock()
+		if err != nil {
+			break
+		}
+		switch blk := blk.(type) {
+		case *Frame:
+			blocks = append(blocks, blk.Image.Rect.String())
+		case *Comment:
+			blocks = append(blocks, blk.Strings[0])
+		}
+	}
+	// later frames only hold the changed pixels, and the comment keeps its place
+	if want := []string{"(0,0)-(4,4)", "hi", "(0,0)-(2,2)", "(1,1)-(3,3)"}; !reflect.DeepEqual(blocks, want) {
+		t.Fatal("unexpected blocks:", blocks, "want:", want)
+	}
+
+	got, err := DecodeAll(out)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	c := Coalesce(got)
+	for i, pm := range g.Image {
+		for j := range pm.Pix {
+			x, y := j%4, j/4
+			if c0, c1 := c.Image[i].At(x, y), pm.At(x, y); colorKey(c0) != colorKey(c1) {
+				t.Fatalf("frame %d pixel %d,%d: got %v, want %v", i, x, y, c0, c1)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package gifhttp serves live-generated GIF animations over HTTP.
+//
+// Browsers display each frame of a GIF as soon as it arrives, so a response that writes frames
+// as they are produced, and never sends the trailer until it has to, shows a live animation
+// without any client-side code.
+package gifhttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// Options are the parameters for NewHandler.
+type Options struct {
+	// Config is the logical screen size and optional global color table. A zero size uses the
+	// bounds of the first image, and a nil color model uses the first frame's palette.
+	Config image.Config
+	// MaxStreams limits the number of responses streamed at once. Further requests are
+	// rejected with 503 Service Unavailable. Zero means no limit.
+	MaxStreams int
+	// MaxDuration ends each response after the given time. Zero means no limit.
+	MaxDuration time.Duration
+}
+
+type handler struct {
+	newSource func(r *http.Request) (gif.FrameSource, error)
+	opts      Options
+	streams   chan struct{}
+}
+
+// NewHandler returns a handler that streams the images of a new source for each request, passed
+// through a live gif.Pipeline that quantizes and optimizes them. An error from newSource is
+// reported as 400 Bad Request, since sources typically fail on invalid request parameters.
+// Each frame is flushed to the client as soon as it is written, and the trailer is written
+// when the source ends, the client disconnects or the maximum duration passes. A source that
+// ends without any image, or fails before anything is sent, is reported as 500 Internal Server
+// Error, without exposing the error itself.
+func NewHandler(newSource func(r *http.Request) (gif.FrameSource, error), opts *Options) http.Handler {
+	h := &handler{newSource: newSource}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.MaxStreams > 0 {
+		h.streams = make(chan struct{}, h.opts.MaxStreams)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.streams != nil {
+		select {
+		case h.streams <- struct{}{}:
+			defer func() { <-h.streams }()
+		default:
+			http.Error(w, "too many streams", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	src, err := h.newSource(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if h.opts.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.MaxDuration)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	fw := &flushWriter{Writer: bufio.NewWriter(w), rc: http.NewResponseController(w)}
+	cs := &countingSource{FrameSource: src}
+	p := gif.NewPipeline(gif.NewEncoder(fw), cs, &gif.PipelineOptions{
+		Config:    h.opts.Config,
+		LoopCount: -1,
+		Optimize:  true,
+		Live:      true,
+	})
+	if err := p.Run(ctx); err != nil && !fw.flushed && ctx.Err() == nil {
+		// nothing has been sent, so the response can still report the failure
+		if cs.frames == 0 && cs.eof {
+			http.Error(w, "no frames", http.StatusInternalServerError)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+}
+
+// countingSource counts the images of a source, to tell an empty source from a failure.
+type countingSource struct {
+	gif.FrameSource
+	frames int
+	eof    bool
+}
+
+func (s *countingSource) Next(ctx context.Context) (image.Image, time.Duration, error) {
+	m, delay, err := s.FrameSource.Next(ctx)
+	if err == nil {
+		s.frames++
+	} else if err == io.EOF {
+		s.eof = true
+	}
+	return m, delay, err
+}
+
+// flushWriter flushes buffered output all the way to the client.
+type flushWriter struct {
+	*bufio.Writer
+	rc      *http.ResponseController
+	flushed bool
+}
+
+func (w *flushWriter) Flush() error {
+	w.flushed = true
+	if err := w.Writer.Flush(); err != nil {
+		return err
+	}
+	if err := w.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
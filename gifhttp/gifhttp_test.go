@@ -0,0 +1,126 @@
+package gifhttp
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+var palette = color.Palette{color.Black, color.White, color.Transparent}
+
+func TestHandler(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	n := 0
+	h := NewHandler(func(*http.Request) (gif.FrameSource, error) {
+		return gif.FrameSourceFunc(func(context.Context) (image.Image, time.Duration, error) {
+			if n == 3 {
+				return nil, 0, io.EOF
+			}
+			// reuse the same image, changing a single pixel each time
+			pm.Pix[n] = 1
+			n++
+			return pm, 50 * time.Millisecond, nil
+		}), nil
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/gif" || rec.Header().Get("Cache-Control") == "" {
+		t.Fatal("unexpected response:", rec.Code, rec.Header())
+	}
+	if !rec.Flushed {
+		t.Fatal("expected response to be flushed")
+	}
+	g, err := gif.DecodeAll(rec.Body)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if len(g.Image) != 3 || g.Config.Width != 4 || g.Config.Height != 4 || g.Delay[2] != 5 {
+		t.Fatal("unexpected animation:", len(g.Image), g.Config.Width, g.Config.Height, g.Delay)
+	}
+	// later frames only hold the changed pixel
+	for i, want := range []image.Rectangle{image.Rect(0, 0, 4, 4), image.Rect(1, 0, 2, 1), image.Rect(2, 0, 3, 1)} {
+		if g.Image[i].Rect != want {
+			t.Fatalf("frame %d: got bounds %v, want %v", i, g.Image[i].Rect, want)
+		}
+	}
+	if g.Image[0].Pix[0] != 1 || g.Image[0].Pix[1] != 0 {
+		t.Fatal("first frame was modified by later frames")
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	started := make(chan struct{})
+	h := NewHandler(func(req *http.Request) (gif.FrameSource, error) {
+		if req.FormValue("bad") != "" {
+			return nil, errors.New("bad request")
+		}
+		first := true
+		return gif.ImageFunc(func(ctx context.Context) (image.Image, error) {
+			if first {
+				first = false
+				return image.NewPaletted(image.Rect(0, 0, 1, 1), palette), nil
+			}
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, 0), nil
+	}, &Options{MaxStreams: 1, MaxDuration: 100 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?bad=1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("expected bad request, got", rec.Code)
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- rec
+	}()
+	<-started
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatal("expected service unavailable, got", rec.Code)
+	}
+
+	// the stream ends with a trailer once the maximum duration passes
+	rec = <-done
+	if g, err := gif.DecodeAll(rec.Body); err != nil || len(g.Image) != 1 {
+		t.Fatal("unexpected stream:", err)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"empty", io.EOF, "no frames\n"},
+		{"failed", errors.New("camera offline"), "Internal Server Error\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(func(*http.Request) (gif.FrameSource, error) {
+				return gif.FrameSourceFunc(func(context.Context) (image.Image, time.Duration, error) {
+					return nil, 0, tc.err
+				}), nil
+			}, nil)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != http.StatusInternalServerError || rec.Body.String() != tc.want {
+				t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package gif
+
+import (
+	"bytes"
+	"compress/lzw"
+	"errors"
+	"image"
+	"image/color"
+	"sort"
+)
+
+// PromoteGlobalPalette chooses the global color table that minimizes the encoded size of the
+// given GIF, considering the existing global palette, each image palette and the union of all
+// colors used. Each image whose colors are all present in the chosen palette is remapped onto
+// it so that no local color table is needed. Image data sizes are measured by LZW compressing
+// each image, so this is considerably slower than encoding alone.
+// When BackgroundIndex is non-zero or any frame uses DisposalBackground, only palettes
+// containing the background color are considered, and the existing global palette is kept
+// if none of them is smaller.
+func PromoteGlobalPalette(g *GIF) {
+	var refs []uint8
+	if g.BackgroundIndex != 0 || bytes.IndexByte(g.Disposal, DisposalBackground) >= 0 {
+		refs = append(refs, g.BackgroundIndex)
+	}
+	promoteGlobalPalette(g, refs)
+}
+
+// promoteGlobalPalette is like PromoteGlobalPalette, but only considers palettes containing
+// the colors of the existing global palette at the given indexes.
+func promoteGlobalPalette(g *GIF, refs []uint8) {
+	gp, _ := g.Config.ColorModel.(color.Palette)
+	var refKeys []uint32
+	for _, i := range refs {
+		if int(i) < len(gp) {
+			refKeys = append(refKeys, colorKey(gp[i]))
+		}
+	}
+
+	frames := make([]*image.Paletted, 0, len(g.Image))
+	seen := make(map[*image.Paletted]bool)
+	for _, pm := range g.Image {
+		if !seen[pm] && len(pm.Palette) > 0 {
+			seen[pm] = true
+			frames = append(frames, pm)
+		}
+	}
+	if len(frames) == 0 {
+		return
+	}
+
+	var candidates []color.Palette
+	ids := make(map[*color.Color]bool)
+	if len(gp) > 0 {
+		candidates = append(candidates, gp)
+		ids[&gp[0]] = true
+	}
+	for _, pm := range frames {
+		if !ids[&pm.Palette[0]] {
+			ids[&pm.Palette[0]] = true
+			candidates = append(candidates, pm.Palette)
+		}
+	}
+	if p := unionPalette(frames); p != nil {
+		candidates = append(candidates, p)
+	}
+
+	sizes := make(map[[2]int]int)
+	lzwSize := func(i int, pm *image.Paletted, litWidth int) int {
+		key := [2]int{i, litWidth}
+		if n, ok := sizes[key]; ok {
+			return n
+		}
+		n := encodedSize(pm, litWidth)
+		sizes[key] = n
+		return n
+	}
+
+	locals := make([]int, len(frames))
+	best := 0
+	for i, pm := range frames {
+		locals[i] = colorTableSize(len(pm.Palette)) + lzwSize(i, pm, litWidth(len(pm.Palette)))
+		best += locals[i]
+	}
+	var bestPalette color.Palette
+	for _, p := range candidates {
+		keys := paletteKeys(p)
+		if !hasKeys(keys, refKeys) {
+			continue
+		}
+		cost := colorTableSize(len(p))
+		for i, pm := range frames {
+			if cost >= best {
+				break
+			}
+			if remapped := remapPalette(pm, p, keys); remapped != nil {
+				cost += lzwSize(i, remapped, litWidth(len(p)))
+			} else {
+				cost += locals[i]
+			}
+		}
+		if cost < best {
+			best, bestPalette = cost, p
+		}
+	}
+
+	if bestPalette == nil {
+		if len(refKeys) == 0 {
+			g.Config.ColorModel = nil
+		}
+		return
+	}
+	if int(g.BackgroundIndex) < len(gp) {
+		if i, ok := paletteKeys(bestPalette)[colorKey(gp[g.BackgroundIndex])]; ok {
+			g.BackgroundIndex = i
+		} else {
+			g.BackgroundIndex = 0
+		}
+	}
+	g.Config.ColorModel = bestPalette
+	keys := paletteKeys(bestPalette)
+	for _, pm := range frames {
+		if remapped := remapPalette(pm, bestPalette, keys); remapped != nil {
+			*pm = *remapped
+		}
+	}
+}
+
+// colorKey identifies colors that encode to the same color table bytes. All fully transparent
+// colors are considered equal.
+func colorKey(c color.Color) uint32 {
+	if r, g, b, a := c.RGBA(); a != 0 {
+		return r>>8<<16 | g>>8<<8 | b>>8
+	}
+	return 1 << 24
+}
+
+// paletteKeys returns the first index of each distinct color in the palette.
+func paletteKeys(p color.Palette) map[uint32]uint8 {
+	keys := make(map[uint32]uint8, len(p))
+	for i := len(p) - 1; i >= 0; i-- {
+		keys[colorKey(p[i])] = uint8(i)
+	}
+	return keys
+}
+
+// hasKeys reports whether all the given color keys are present.
+func hasKeys(keys map[uint32]uint8, want []uint32) bool {
+	for _, k := range want {
+		if _, ok := keys[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// remapCheaper reports whether the remapped copy of pm, which no longer needs a local color
+// table, encodes smaller than pm itself.
+func remapCheaper(pm, remapped *image.Paletted) bool {
+	if remapped == pm {
+		return true
+	}
+	local := colorTableSize(len(pm.Palette)) + encodedSize(pm, litWidth(len(pm.Palette)))
+	return encodedSize(remapped, litWidth(len(remapped.Palette))) < local
+}
+
+// remapPalette returns a copy of pm using the given palette, or nil if any used color is missing.
+func remapPalette(pm *image.Paletted, p color.Palette, keys map[uint32]uint8) *image.Paletted {
+	return remapInto(new(image.Paletted), pm, p, keys)
+}
+
+// remapInto is like remapPalette, but reuses the pixels of dst for the copy.
+func remapInto(dst, pm *image.Paletted, p color.Palette, keys map[uint32]uint8) *image.Paletted {
+	if len(pm.Palette) > 0 && len(p) > 0 && &pm.Palette[0] == &p[0] {
+		return pm
+	}
+
+	var remap [256]int
+	for i := range remap {
+		remap[i] = -1
+	}
+	for i, c := range pm.Palette {
+		if j, ok := keys[colorKey(c)]; ok {
+			remap[i] = int(j)
+		}
+	}
+
+	dx := pm.Rect.Dx()
+	if n := dx * pm.Rect.Dy(); cap(dst.Pix) < n {
+		dst.Pix = make([]uint8, n)
+	} else {
+		dst.Pix = dst.Pix[:n]
+	}
+	dst.Stride = dx
+	dst.Rect = pm.Rect
+	dst.Palette = p
+	j := 0
+	for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+		i := pm.PixOffset(pm.Rect.Min.X, y)
+		for _, c := range pm.Pix[i : i+dx] {
+			if remap[c] < 0 {
+				return nil
+			}
+			dst.Pix[j] = uint8(remap[c])
+			j++
+		}
+	}
+	return dst
+}
+
+// unionPalette returns all colors used by the given images ordered by frequency,
+// or nil if there are more than 256.
+func unionPalette(pms []*image.Paletted) color.Palette {
+	counts := make(map[uint32]int)
+	colors := make(map[uint32]color.Color)
+	for _, pm := range pms {
+		var used [256]int
+		for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+			i := pm.PixOffset(pm.Rect.Min.X, y)
+			for _, c := range pm.Pix[i : i+pm.Rect.Dx()] {
+				used[c]++
+			}
+		}
+		for i, n := range used {
+			if n > 0 && i < len(pm.Palette) {
+				key := colorKey(pm.Palette[i])
+				if _, ok := colors[key]; !ok {
+					colors[key] = pm.Palette[i]
+				}
+				counts[key] += n
+			}
+		}
+	}
+	if len(colors) == 0 || len(colors) > 256 {
+		return nil
+	}
+
+	keys := make([]uint32, 0, len(colors))
+	for key := range colors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	p := make(color.Palette, len(keys))
+	for i, key := range keys {
+		p[i] = colors[key]
+	}
+	return p
+}
+
+func colorTableSize(n int) int {
+	return 3 << (log2(n) + 1)
+}
+
+func litWidth(n int) int {
+	return max(log2(n)+1, 2)
+}
+
+// encodedSize returns the number of bytes of LZW compressed image data, including sub-block headers.
+func encodedSize(pm *image.Paletted, litWidth int) int {
+	var w countingWriter
+	lzww := lzw.NewWriter(&w, lzw.LSB, litWidth)
+	for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+		i := pm.PixOffset(pm.Rect.Min.X, y)
+		if _, err := lzww.Write(pm.Pix[i : i+pm.Rect.Dx()]); err != nil {
+			break
+		}
+	}
+	_ = lzww.Close()
+	return int(w) + int(w)/255 + 2
+}
+
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+func (w *countingWriter) WriteByte(byte) error {
+	*w++
+	return nil
+}
+
+// deferredHeader holds the header and blocks written before the global color table is chosen.
+type deferredHeader struct {
+	hdr       Header
+	lookahead int
+	frames    int
+	blocks    []any
+}
+
+// WriteHeaderDeferred defers writing the given header until the given number of frames have
+// been written, or the trailer is reached. The global color table is then chosen from those
+// frames using PromoteGlobalPalette, and each subsequent frame whose colors are present in it
+// is remapped onto it when that makes the frame smaller. Until then, blocks are held in memory
+// and Flush has no effect. Plain text color indexes, which refer to the global color table of
+// the given header, are remapped onto the chosen table, and only tables containing the colors
+// of the plain text held back are considered.
+func (e *Encoder) WriteHeaderDeferred(hdr *Header, lookahead int) error {
+	if lookahead < 1 {
+		lookahead = 1
+	}
+	e.state().deferred = &deferredHeader{hdr: *hdr, lookahead: lookahead}
+	return nil
+}
+
+// deferBlock holds the given block until the global color table has been chosen.
+func (e *Encoder) deferBlock(blk any) error {
+	d := e.state().deferred
+	if f, ok := blk.(*Frame); ok {
+		pm := *f.Image
+		pm.Pix = make([]uint8, len(f.Image.Pix))
+		copy(pm.Pix, f.Image.Pix)
+		pm.Palette = append(color.Palette(nil), f.Image.Palette...)
+		blk = &Frame{Image: &pm, DelayTime: f.DelayTime, DisposalMethod: f.DisposalMethod}
+		d.frames++
+	}
+	d.blocks = append(d.blocks, blk)
+	if d.frames < d.lookahead {
+		return nil
+	}
+	return e.resolveDeferred()
+}
+
+// resolveDeferred chooses the global color table then writes the header and all held blocks.
+func (e *Encoder) resolveDeferred() error {
+	s := e.state()
+	d := s.deferred
+	s.deferred = nil
+
+	g := &GIF{Config: d.hdr.Config, BackgroundIndex: d.hdr.BackgroundIndex}
+	var refs []uint8
+	if g.BackgroundIndex != 0 {
+		refs = append(refs, g.BackgroundIndex)
+	}
+	for _, blk := range d.blocks {
+		switch blk := blk.(type) {
+		case *Frame:
+			g.Image = append(g.Image, blk.Image)
+			if blk.DisposalMethod == DisposalBackground {
+				refs = append(refs, g.BackgroundIndex)
+			}
+		case *PlainText:
+			refs = append(refs, blk.TextForegroundColorIndex, blk.TextBackgroundColorIndex)
+		}
+	}
+	gp, _ := g.Config.ColorModel.(color.Palette)
+	promoteGlobalPalette(g, refs)
+
+	hdr := d.hdr
+	hdr.Config = g.Config
+	hdr.BackgroundIndex = g.BackgroundIndex
+	if err := e.WriteHeaderFrom(&hdr); err != nil {
+		return err
+	}
+	if p, ok := g.Config.ColorModel.(color.Palette); ok && len(p) > 0 {
+		s.globalKeys = paletteKeys(p)
+		if len(gp) > 0 && &p[0] != &gp[0] {
+			s.textPalette = gp
+		}
+	}
+
+	for _, blk := range d.blocks {
+		var err error
+		switch blk := blk.(type) {
+		case *PlainText:
+			err = e.WritePlainText(blk)
+		case *Comment:
+			err = e.WriteComment(blk)
+		case *ApplicationNetscape:
+			err = e.WriteApplicationNetscape(blk)
+		case *UnknownApplication:
+			err = e.WriteUnknownApplication(blk)
+		case *UnknownExtension:
+			err = e.WriteUnknownExtension(blk)
+		case *Frame:
+			err = e.WriteFrame(blk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remapPlainText returns pt with its color indexes remapped from the global color table of the
+// header given to WriteHeaderDeferred onto the chosen one.
+func (e *Encoder) remapPlainText(pt *PlainText) (*PlainText, error) {
+	s := e.state()
+	if s.textPalette == nil {
+		return pt, nil
+	}
+	c := *pt
+	for _, i := range []*byte{&c.TextForegroundColorIndex, &c.TextBackgroundColorIndex} {
+		if int(*i) >= len(s.textPalette) {
+			continue
+		}
+		j, ok := s.globalKeys[colorKey(s.textPalette[*i])]
+		if !ok {
+			return nil, errors.New("gif: plain text color missing from global color table")
+		}
+		*i = j
+	}
+	return &c, nil
+}
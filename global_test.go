@@ -0,0 +1,296 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestPromoteGlobalPalette(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	newFrame := func(p color.Palette, pix ...uint8) *image.Paletted {
+		pm := image.NewPaletted(image.Rect(0, 0, 2, 2), p)
+		copy(pm.Pix, pix)
+		return pm
+	}
+	gp := color.Palette{black, white}
+	g := &GIF{
+		Image: []*image.Paletted{
+			newFrame(color.Palette{white, black}, 0, 1, 1, 0),
+			newFrame(color.Palette{red, white, black}, 1, 2, 0, 0),
+			newFrame(color.Palette{black, white}, 0, 0, 1, 1),
+		},
+		Delay:           []int{0, 0, 0},
+		Config:          image.Config{Width: 2, Height: 2, ColorModel: gp},
+		BackgroundIndex: 1,
+	}
+	want := make([][]color.Color, len(g.Image))
+	for i, pm := range g.Image {
+		for _, c := range pm.Pix {
+			want[i] = append(want[i], pm.Palette[c])
+		}
+	}
+
+	var before, after bytes.Buffer
+	if err := EncodeAll(&before, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	PromoteGlobalPalette(g)
+	if err := EncodeAll(&after, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	if after.Len() >= before.Len() {
+		t.Fatal("promoted GIF not smaller:", after.Len(), before.Len())
+	}
+
+	p := g.Config.ColorModel.(color.Palette)
+	if len(p) != 3 || p[g.BackgroundIndex] != white {
+		t.Fatal("unexpected global palette:", p, g.BackgroundIndex)
+	}
+	for i, pm := range g.Image {
+		if &pm.Palette[0] != &p[0] {
+			t.Fatal("frame", i, "not remapped onto global palette")
+		}
+		for j, c := range pm.Pix {
+			if pm.Palette[c] != want[i][j] {
+				t.Fatal("frame", i, "unexpected pixel", j, "got:", pm.Palette[c], "want:", want[i][j])
+			}
+		}
+	}
+}
+
+func TestWriteHeaderDeferred(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderDeferred(&Header{Version: "GIF89a", Config: image.Config{Width: 2, Height: 1}}, 2); err != nil {
+		t.Fatal("WriteHeaderDeferred:", err)
+	}
+	pm := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{black, white})
+	for i, p := range []color.Palette{{black, white}, {white, black}, {white, black}, {red, black}} {
+		pm.Palette = p
+		pm.Pix[0], pm.Pix[1] = uint8(i%2), uint8(1-i%2)
+		if err := enc.WriteFrame(&Frame{Image: pm}); err != nil {
+			t.Fatal("WriteFrame:", err)
+		}
+		if i == 0 {
+			if err := enc.Flush(); err != nil {
+				t.Fatal("Flush:", err)
+			} else if buf.Len() > 0 {
+				t.Fatal("unexpected output before lookahead reached")
+			}
+		}
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	g, err := DecodeAll(buf)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	gp := g.Config.ColorModel.(color.Palette)
+	if len(gp) != 2 {
+		t.Fatal("unexpected global palette:", gp)
+	}
+	for i, want := range [][2]color.Color{{black, white}, {black, white}, {white, black}, {black, red}} {
+		pm := g.Image[i]
+		if pm.At(0, 0) != want[0] || pm.At(1, 0) != want[1] {
+			t.Fatal("frame", i, "unexpected pixels:", pm.At(0, 0), pm.At(1, 0))
+		}
+		if global := &pm.Palette[0] == &gp[0]; global != (i < 3) {
+			t.Fatal("frame", i, "unexpected use of global palette:", global)
+		}
+	}
+}
+
+func TestWriteHeaderDeferredReusedPalette(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderDeferred(&Header{Config: image.Config{Width: 1, Height: 1}}, 2); err != nil {
+		t.Fatal("WriteHeaderDeferred:", err)
+	}
+	// the caller reuses both the pixels and the palette storage
+	pm := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{black, white})
+	for i := 0; i < 2; i++ {
+		pm.Palette[0], pm.Palette[1] = pm.Palette[1], pm.Palette[0]
+		if err := enc.WriteFrame(&Frame{Image: pm}); err != nil {
+			t.Fatal("WriteFrame:", err)
+		}
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	g, err := DecodeAll(buf)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if c0, c1 := g.Image[0].At(0, 0), g.Image[1].At(0, 0); c0 != white || c1 != black {
+		t.Fatal("unexpected pixels:", c0, c1)
+	}
+}
+
+func TestWriteHeaderDeferredPlainText(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	green := color.RGBA{G: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	gp := color.Palette{black, white, red, green, blue}
+	if err := enc.WriteHeaderDeferred(&Header{Version: "GIF89a", Config: image.Config{Width: 2, Height: 1, ColorModel: gp}}, 2); err != nil {
+		t.Fatal("WriteHeaderDeferred:", err)
+	}
+	pt := &PlainText{TextGridWidth: 2, TextGridHeight: 1, CharacterCellWidth: 1, CharacterCellHeight: 1, TextForegroundColorIndex: 2, TextBackgroundColorIndex: 1, Strings: []string{"hi"}}
+	if err := enc.WritePlainText(pt); err != nil {
+		t.Fatal("WritePlainText:", err)
+	}
+	pm := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{white, red, black})
+	pm.Pix[1] = 1
+	for i := 0; i < 2; i++ {
+		if err := enc.WriteFrame(&Frame{Image: pm}); err != nil {
+			t.Fatal("WriteFrame:", err)
+		}
+	}
+	if err := enc.WritePlainText(pt); err != nil {
+		t.Fatal("WritePlainText:", err)
+	}
+	if err := enc.WritePlainText(&PlainText{TextForegroundColorIndex: 3, Strings: []string{"x"}}); err == nil {
+		t.Fatal("expected error for plain text color missing from global color table")
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	dec := NewDecoder(buf)
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	p := hdr.Config.ColorModel.(color.Palette)
+	if len(p) >= len(gp) {
+		t.Fatal("global palette not replaced:", p)
+	}
+	texts := 0
+	for {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("ReadBlock:", err)
+		}
+		if pt, ok := blk.(*PlainText); ok {
+			texts++
+			if p[pt.TextForegroundColorIndex] != red || p[pt.TextBackgroundColorIndex] != white {
+				t.Fatal("unexpected plain text colors:", p[pt.TextForegroundColorIndex], p[pt.TextBackgroundColorIndex])
+			}
+		}
+	}
+	if texts != 2 {
+		t.Fatal("unexpected plain text count:", texts)
+	}
+}
+
+func TestWriteHeaderDeferredKeepsReferencedPalette(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	gp := color.Palette{black, white, color.RGBA{R: 0xff, A: 0xff}}
+	if err := enc.WriteHeaderDeferred(&Header{Version: "GIF89a", Config: image.Config{Width: 1, Height: 1, ColorModel: gp}, BackgroundIndex: 2}, 1); err != nil {
+		t.Fatal("WriteHeaderDeferred:", err)
+	}
+	pm := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{white, black})
+	if err := enc.WriteFrame(&Frame{Image: pm, DisposalMethod: DisposalBackground}); err != nil {
+		t.Fatal("WriteFrame:", err)
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	g, err := DecodeAll(buf)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if p, _ := g.Config.ColorModel.(color.Palette); !palettesEqual(p, gp) || g.BackgroundIndex != 2 {
+		t.Fatal("global palette not kept:", p, g.BackgroundIndex)
+	}
+}
+
+func TestWriteHeaderDeferredRemapCost(t *testing.T) {
+	gp := make(color.Palette, 256)
+	for i := range gp {
+		gp[i] = color.Gray{Y: uint8(i)}
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderDeferred(&Header{Config: image.Config{Width: 64, Height: 64}}, 2); err != nil {
+		t.Fatal("WriteHeaderDeferred:", err)
+	}
+	pm := image.NewPaletted(image.Rect(0, 0, 64, 64), gp)
+	for i := range pm.Pix {
+		pm.Pix[i] = uint8(i)
+	}
+	for i := 0; i < 2; i++ {
+		if err := enc.WriteFrame(&Frame{Image: pm}); err != nil {
+			t.Fatal("WriteFrame:", err)
+		}
+	}
+	// a two color frame is smaller with its own table than remapped onto 256 entries
+	rnd := rand.New(rand.NewSource(1))
+	bw := image.NewPaletted(pm.Rect, color.Palette{gp[0], gp[255]})
+	for i := range bw.Pix {
+		bw.Pix[i] = uint8(rnd.Intn(2))
+	}
+	if err := enc.WriteFrame(&Frame{Image: bw}); err != nil {
+		t.Fatal("WriteFrame:", err)
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	g, err := DecodeAll(buf)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if n := len(g.Config.ColorModel.(color.Palette)); n != 256 {
+		t.Fatal("unexpected global palette size:", n)
+	}
+	if p := g.Image[2].Palette; len(p) != 2 {
+		t.Fatal("frame remapped onto larger global palette:", len(p))
+	}
+}
+
+func TestRemapIntoAllocs(t *testing.T) {
+	gp := color.Palette{black, white}
+	keys := paletteKeys(gp)
+	pm := image.NewPaletted(image.Rect(1, 1, 5, 3), color.Palette{white, black})
+	pm.Pix[3] = 1
+	dst := &image.Paletted{}
+	if n := testing.AllocsPerRun(10, func() {
+		if remapInto(dst, pm, gp, keys) != dst {
+			t.Fatal("not remapped")
+		}
+	}); n > 0 {
+		t.Fatal("unexpected allocations:", n)
+	}
+	if dst.Rect != pm.Rect || dst.At(1, 1) != white || dst.At(4, 1) != black {
+		t.Fatal("unexpected remap:", dst.Rect, dst.Pix)
+	}
+}
@@ -1,8 +1,11 @@
 package gif
 
 import (
+	"context"
 	"errors"
 	"image"
+	"image/color"
+	"io"
 )
 
 // OptimizeAll takes a slice of images and replaces unchanged pixels with the transparent
@@ -29,19 +32,24 @@ func NewOptimizer(transparentIndex uint8) *Optimizer {
 }
 
 type Optimizer struct {
-	pm *image.Paletted
-	xs []uint8
+	pm      *image.Paletted
+	xs      []uint8
+	pal     color.Palette // copy of the previous palette
+	changed [256]bool     // palette entries whose color differs from the previous palette
 }
 
 // Optimize compares the given image with the previous frame and replaces identical pixels
 // with the transparent palette index. The smallest possible sub-image containing all
-// changed pixels is returned.
+// changed pixels is returned. Pixels keeping their index count as changed if the palette entry
+// now holds a different color, so palettes may be updated in place between frames, as
+// AnimationQuantizer does.
 // The first image passed cannot be optimized and is only used to initialize the internal
 // image buffer.
 func (o *Optimizer) Optimize(pm *image.Paletted) (*image.Paletted, error) {
 	if o.pm == nil {
 		o.pm = image.NewPaletted(pm.Rect, pm.Palette)
 		copy(o.pm.Pix, pm.Pix)
+		o.pal = append(o.pal[:0], pm.Palette...)
 		return pm, nil
 	}
 
@@ -49,6 +57,11 @@ func (o *Optimizer) Optimize(pm *image.Paletted) (*image.Paletted, error) {
 		return nil, errors.New("image outside bounds")
 	}
 
+	for i := range o.changed {
+		o.changed[i] = i < len(pm.Palette) && (i >= len(o.pal) || colorKey(pm.Palette[i]) != colorKey(o.pal[i]))
+	}
+	o.pal = append(o.pal[:0], pm.Palette...)
+
 	var crop image.Rectangle
 	if pm.Rect.Eq(o.pm.Rect) && len(pm.Pix) == len(o.pm.Pix) {
 		// fast path that directly optimizes the raw pixels
@@ -67,14 +80,19 @@ func (o *Optimizer) Optimize(pm *image.Paletted) (*image.Paletted, error) {
 	return pm, nil
 }
 
+// same reports whether a pixel with the given index can be left showing the previous one.
+func (o *Optimizer) same(c, prev uint8) bool {
+	return c == prev && !o.changed[c] || c == o.xs[0]
+}
+
 func (o *Optimizer) optimizeByPix(pm *image.Paletted) image.Rectangle {
 	var crop image.Rectangle
 	var same bool
 	var i0, x0, y0 int
 	for i := 0; i <= len(pm.Pix); i++ {
 		if i == 0 {
-			same = pm.Pix[i] == o.pm.Pix[i] || pm.Pix[i] == o.xs[0]
-		} else if i == len(pm.Pix) || (pm.Pix[i] == o.pm.Pix[i] || pm.Pix[i] == o.xs[0]) != same {
+			same = o.same(pm.Pix[i], o.pm.Pix[i])
+		} else if i == len(pm.Pix) || o.same(pm.Pix[i], o.pm.Pix[i]) != same {
 			x := i % pm.Stride
 			y := i / pm.Stride
 			if same {
@@ -112,10 +130,10 @@ func (o *Optimizer) optimizeByLine(pm *image.Paletted) image.Rectangle {
 		var i0, j0 int
 		for x := x0; x <= pm.Rect.Max.X; x++ {
 			if x == x0 {
-				same = pm.Pix[j] == o.pm.Pix[i] || pm.Pix[j] == o.xs[0]
+				same = o.same(pm.Pix[j], o.pm.Pix[i])
 				i0, j0 = i, j
 			} else {
-				if x == pm.Rect.Max.X || (pm.Pix[j] == o.pm.Pix[i] || pm.Pix[j] == o.xs[0]) != same {
+				if x == pm.Rect.Max.X || o.same(pm.Pix[j], o.pm.Pix[i]) != same {
 					if same {
 						for len(o.xs) < j-j0 {
 							o.xs = append(o.xs, o.xs...)
@@ -140,3 +158,70 @@ func (o *Optimizer) optimizeByLine(pm *image.Paletted) image.Rectangle {
 	}
 	return crop
 }
+
+// OptimizeCoalesced optimizes full logical screen frames, as produced by Coalesce, in place.
+// Consecutive frames are only optimized against each other when they share the same palette
+// and the earlier frame is not disposed. Palettes without a transparent entry are extended
+// with one where possible.
+func OptimizeCoalesced(g *GIF) {
+	gp, _ := g.Config.ColorModel.(color.Palette)
+	var ep color.Palette
+	fo := &frameOptimizer{}
+	for i, pm := range g.Image {
+		p := pm.Palette
+		f := &Frame{Image: pm}
+		if g.Disposal != nil {
+			f.DisposalMethod = g.Disposal[i]
+		}
+		g.Image[i] = fo.optimize(f).Image
+		if len(gp) > 0 && samePalette(gp, p) {
+			ep = pm.Palette
+		}
+	}
+	if ep != nil {
+		g.Config.ColorModel = ep
+	}
+}
+
+// OptimizeStream re-encodes the GIF read from dec so that each frame only stores the pixels
+// that changed since the previous one. Frames are coalesced and streamed one at a time, and the
+// global color table is chosen again once a few frames have been seen, since optimized frames
+// may need a transparent entry that it lacks. Other blocks are copied unchanged.
+func OptimizeStream(enc *Encoder, dec *Decoder) error {
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+	hdr.Version = ""
+	if err := enc.WriteHeaderDeferred(hdr, 8); err != nil {
+		return err
+	}
+
+	c := NewCoalescer(hdr.Config)
+	w := newFrameWriter(enc, true)
+	for {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if f, ok := blk.(*Frame); ok {
+			err = w.frame(context.Background(), c.Coalesce(f))
+		} else {
+			err = w.block(blk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.flush(context.Background()); err != nil {
+		return err
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
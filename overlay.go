@@ -0,0 +1,128 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+)
+
+// Overlay returns a copy of the given GIF with the given image, such as a watermark or the
+// result of TextImage, drawn with its top left corner at the given point on each of the given
+// frames, or on every frame if none are given. Partially transparent overlay pixels are
+// blended with the frame beneath them. Each resulting color is mapped onto the frame's palette,
+// which is extended with the colors it lacks while room remains, otherwise the nearest color
+// is used. Frames are coalesced before drawing and then re-optimized, so an overlay that is
+// the same on consecutive frames is only stored once.
+func Overlay(g *GIF, m image.Image, pt image.Point, frames ...int) *GIF {
+	c := Coalesce(g)
+	selected := make([]bool, len(c.Image))
+	for i := range selected {
+		selected[i] = len(frames) == 0
+	}
+	for _, i := range frames {
+		if i >= 0 && i < len(selected) {
+			selected[i] = true
+		}
+	}
+
+	src := toRGBA(m)
+	r := src.Rect.Sub(src.Rect.Min).Add(pt).Intersect(image.Rect(0, 0, c.Config.Width, c.Config.Height))
+	palettes := make(map[*color.Color]*overlayPalette)
+	for i, pm := range c.Image {
+		if !selected[i] || len(pm.Palette) == 0 {
+			continue
+		}
+		op, ok := palettes[&pm.Palette[0]]
+		if !ok {
+			op = &overlayPalette{p: pm.Palette, keys: paletteKeys(pm.Palette)}
+			palettes[&pm.Palette[0]] = op
+		}
+		vis := r.Intersect(pm.Rect)
+		for y := vis.Min.Y; y < vis.Max.Y; y++ {
+			s := src.PixOffset(src.Rect.Min.X+vis.Min.X-pt.X, src.Rect.Min.Y+y-pt.Y)
+			d := pm.PixOffset(vis.Min.X, y)
+			for x := vis.Min.X; x < vis.Max.X; x, s, d = x+1, s+4, d+1 {
+				if col, ok := blend(src.Pix[s:s+4], pm.Palette[pm.Pix[d]]); ok {
+					pm.Pix[d] = op.index(col)
+				}
+			}
+		}
+	}
+
+	// Extended palettes only append entries, so every frame that shared the original palette
+	// can share the extended one, which keeps those frames optimizable against each other.
+	for _, pm := range c.Image {
+		if len(pm.Palette) > 0 {
+			if op, ok := palettes[&pm.Palette[0]]; ok {
+				pm.Palette = op.p
+			}
+		}
+	}
+	if gp, ok := c.Config.ColorModel.(color.Palette); ok && len(gp) > 0 {
+		if op, ok := palettes[&gp[0]]; ok {
+			c.Config.ColorModel = op.p
+		}
+	}
+
+	OptimizeCoalesced(c)
+	return c
+}
+
+// blend composites the given premultiplied source pixel over the given color, reporting false
+// if the result is less than half opaque.
+func blend(src []uint8, dst color.Color) (color.RGBA, bool) {
+	if src[3] == 0 {
+		return color.RGBA{}, false
+	}
+	dr, dg, db, da := dst.RGBA()
+	inv := uint32(0xff - src[3])
+	out := []uint8{
+		src[0] + uint8(dr>>8*inv/0xff),
+		src[1] + uint8(dg>>8*inv/0xff),
+		src[2] + uint8(db>>8*inv/0xff),
+		src[3] + uint8(da>>8*inv/0xff),
+	}
+	if out[3] < 0x80 {
+		return color.RGBA{}, false
+	}
+	return unpremultiply(out), true
+}
+
+// overlayPalette is a palette that grows as overlay colors are added to it.
+type overlayPalette struct {
+	p      color.Palette
+	keys   map[uint32]uint8
+	copied bool
+	opaque color.Palette
+	remap  []uint8
+}
+
+func (op *overlayPalette) index(c color.RGBA) uint8 {
+	key := colorKey(c)
+	if i, ok := op.keys[key]; ok {
+		return i
+	}
+
+	var i uint8
+	if len(op.p) < 256 {
+		if !op.copied {
+			op.p = append(color.Palette(nil), op.p...)
+			op.copied = true
+		}
+		i = uint8(len(op.p))
+		op.p = append(op.p, c)
+	} else {
+		if op.opaque == nil {
+			for j, pc := range op.p {
+				if _, _, _, a := pc.RGBA(); a != 0 {
+					op.opaque = append(op.opaque, pc)
+					op.remap = append(op.remap, uint8(j))
+				}
+			}
+		}
+		if len(op.opaque) > 0 {
+			i = op.remap[op.opaque.Index(c)]
+		}
+	}
+	op.keys[key] = i
+	return i
+}
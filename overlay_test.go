@@ -0,0 +1,102 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	darkRed := color.RGBA{R: 0x80, A: 0xff}
+	p := color.Palette{black, white}
+	newGIF := func() *GIF {
+		g := &GIF{Delay: []int{10, 10, 10}, Config: image.Config{Width: 4, Height: 4, ColorModel: p}}
+		for i := 0; i < 3; i++ {
+			pm := image.NewPaletted(image.Rect(0, 0, 4, 4), p)
+			pm.Pix[15] = uint8(i % 2)
+			g.Image = append(g.Image, pm)
+		}
+		return g
+	}
+	mark := image.NewRGBA(image.Rect(10, 10, 12, 12))
+	copy(mark.Pix, []uint8{0xff, 0, 0, 0xff, 0x80, 0, 0, 0x80, 0, 0, 0, 0, 0xff, 0, 0, 0xff})
+
+	testCases := []struct {
+		name   string
+		frames []int
+		marked []bool
+	}{
+		{"all", nil, []bool{true, true, true}},
+		{"selected", []int{1}, []bool{false, true, false}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newGIF()
+			out := Overlay(g, mark, image.Pt(1, 1), tc.frames...)
+			if len(g.Image[0].Palette) != 2 || g.Image[0].Pix[5] != 0 {
+				t.Fatal("input modified")
+			}
+			if tc.frames == nil {
+				if out.Image[1].Rect.Overlaps(image.Rect(1, 1, 3, 3)) {
+					t.Fatal("overlay not optimized:", out.Image[1].Rect)
+				}
+				if gp := out.Config.ColorModel.(color.Palette); len(gp) < 4 {
+					t.Fatal("global palette not extended:", gp)
+				}
+			}
+
+			buf := &bytes.Buffer{}
+			if err := EncodeAll(buf, out); err != nil {
+				t.Fatal("EncodeAll:", err)
+			}
+			d, err := DecodeAll(buf)
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			c := Coalesce(d)
+			for i, pm := range c.Image {
+				wants := []color.Color{black, black, black, black}
+				if tc.marked[i] {
+					wants = []color.Color{red, darkRed, black, red}
+				}
+				for j, want := range wants {
+					if got := pm.At(1+j%2, 1+j/2); colorKey(got) != colorKey(want) {
+						t.Fatal("frame", i, "unexpected pixel", j, "got:", got, "want:", want)
+					}
+				}
+				if got := pm.At(3, 3); colorKey(got) != colorKey(p[i%2]) {
+					t.Fatal("frame", i, "unexpected unmarked pixel:", got)
+				}
+			}
+		})
+	}
+}
+
+func TestTextImage(t *testing.T) {
+	m := TextImage("A\nhi", white, 2)
+	if b := m.Bounds(); b != image.Rect(0, 0, 24, 32) {
+		t.Fatal("unexpected bounds:", b)
+	}
+	testCases := []struct {
+		x, y int
+		set  bool
+	}{
+		{0, 0, false}, // top left corner of 'A' is empty
+		{2, 0, true},
+		{1, 3, true},
+		{0, 2, true}, // left stroke of 'A'
+		{10, 2, false},
+		{11, 15, false}, // gap between lines
+		{0, 16, true},   // 'h' stem
+		{16, 16, true},  // dot of 'i'
+		{22, 16, false}, // gap after 'i'
+	}
+	for _, tc := range testCases {
+		if _, _, _, a := m.At(tc.x, tc.y).RGBA(); (a != 0) != tc.set {
+			t.Fatal("unexpected pixel", tc.x, tc.y)
+		}
+	}
+}
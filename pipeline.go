@@ -0,0 +1,328 @@
+package gif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"time"
+)
+
+// FrameSource produces the images of an animation for a Pipeline.
+type FrameSource interface {
+	// Next blocks until the next image is ready and returns it with how long it is shown, or
+	// returns io.EOF once the animation is complete. It should return early with the context's
+	// error when the context is done. The image may be reused once Next is called again.
+	Next(ctx context.Context) (image.Image, time.Duration, error)
+}
+
+// FrameSourceFunc adapts an ordinary function to a FrameSource.
+type FrameSourceFunc func(ctx context.Context) (image.Image, time.Duration, error)
+
+func (f FrameSourceFunc) Next(ctx context.Context) (image.Image, time.Duration, error) {
+	return f(ctx)
+}
+
+// ImageFunc returns a FrameSource that calls the given function for each image, shown for the
+// given delay, until it returns an error.
+func ImageFunc(fn func(ctx context.Context) (image.Image, error), delay time.Duration) FrameSource {
+	return FrameSourceFunc(func(ctx context.Context) (image.Image, time.Duration, error) {
+		m, err := fn(ctx)
+		return m, delay, err
+	})
+}
+
+// ImageSlice returns a FrameSource that produces the given images in turn, each shown for the
+// given delay.
+func ImageSlice(ms []image.Image, delay time.Duration) FrameSource {
+	return ImageFunc(func(context.Context) (image.Image, error) {
+		if len(ms) == 0 {
+			return nil, io.EOF
+		}
+		m := ms[0]
+		ms = ms[1:]
+		return m, nil
+	}, delay)
+}
+
+// ImageChan returns a FrameSource that receives images from the given channel until it is
+// closed, each shown for the given delay.
+func ImageChan(ch <-chan image.Image, delay time.Duration) FrameSource {
+	return ImageFunc(func(ctx context.Context) (image.Image, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case m, ok := <-ch:
+			if !ok {
+				return nil, io.EOF
+			}
+			return m, nil
+		}
+	}, delay)
+}
+
+// FrameChan returns a FrameSource that receives frames from the given channel until it is
+// closed. Disposal methods are ignored, since the pipeline chooses its own.
+func FrameChan(ch <-chan *Frame) FrameSource {
+	return FrameSourceFunc(func(ctx context.Context) (image.Image, time.Duration, error) {
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case f, ok := <-ch:
+			if !ok {
+				return nil, 0, io.EOF
+			}
+			return f.Image, f.DelayTime, nil
+		}
+	})
+}
+
+// PipelineOptions are the parameters for NewPipeline.
+type PipelineOptions struct {
+	// Config is the logical screen size and optional global color table. A zero size uses the
+	// bounds of the first image. A nil color model chooses a global color table from the first
+	// few frames, or uses the palette of the first frame when Live is set.
+	Config image.Config
+	// LoopCount has the same meaning as GIF.LoopCount, and is only written for animations.
+	LoopCount int
+	// NumColors is the maximum number of palette entries used to quantize images that aren't
+	// paletted, including the entry reserved for transparent pixels. Zero means 256.
+	NumColors int
+	// Dither draws quantized images, typically draw.FloydSteinberg, trading smoother gradients
+	// for noise that leaves fewer unchanged pixels to optimize. Nil maps each pixel to the
+	// nearest color, keeping its previous index where that is close enough.
+	Dither draw.Drawer
+	// Optimize only stores the pixels that changed since the previous frame.
+	Optimize bool
+	// MergeDuplicates drops images identical to the previous one, adding their delay to it.
+	MergeDuplicates bool
+	// Live writes and flushes each frame as soon as it is ready, for streaming to viewers.
+	// Otherwise each frame is held until the next arrives, since transparent pixels in the
+	// next image can only clear what the frame drew once its disposal method is changed.
+	// Live frames are instead drawn over the previous frame, so their transparent pixels leave
+	// it showing, and MergeDuplicates is ignored.
+	Live bool
+	// Buffer is the number of images read and quantized ahead of the encoder, concurrently
+	// with encoding. The source isn't asked for more until the encoder catches up. Zero reads
+	// each image once the previous one has been passed to the encoder.
+	Buffer int
+}
+
+// Pipeline reads images from a FrameSource, converts them to frames and writes them to an
+// Encoder, taking care of the header, loop count and trailer.
+type Pipeline struct {
+	enc  *Encoder
+	src  FrameSource
+	opts PipelineOptions
+
+	// Preparing images, which may run ahead of encoding.
+	q *AnimationQuantizer
+
+	// Encoding frames.
+	c      *Coalescer
+	w      *frameWriter
+	last   *image.Paletted // previous image, for MergeDuplicates
+	looped bool            // whether the loop count has been written
+}
+
+// NewPipeline returns a new Pipeline that writes the images of the given source to the given
+// encoder, which must not have been written to.
+func NewPipeline(enc *Encoder, src FrameSource, opts *PipelineOptions) *Pipeline {
+	p := &Pipeline{enc: enc, src: src}
+	if opts != nil {
+		p.opts = *opts
+	}
+	p.w = newFrameWriter(enc, p.opts.Optimize)
+	return p
+}
+
+// Run reads images until the source returns io.EOF, then writes the trailer and flushes the
+// encoder. Images that aren't paletted are quantized with stable palettes, then each is
+// shown in place of the previous one, as it would appear on its own. If the source fails or
+// the context is done, the frames written so far are still ended with a trailer, and the
+// error is returned, unless the context is done partway through encoding a frame, in which
+// case encoding stops at once. Nothing is written if the source has no images.
+func (p *Pipeline) Run(ctx context.Context) error {
+	next := p.next
+	if p.opts.Buffer > 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		next = p.ahead(ctx)
+	}
+
+	var err error
+	for {
+		var f *Frame
+		if f, err = next(ctx); err != nil {
+			break
+		}
+		if err := p.frame(ctx, f); err != nil {
+			return err
+		}
+	}
+	if p.c == nil {
+		if err == io.EOF {
+			return errors.New("gif: missing image data")
+		}
+		return err
+	}
+
+	// the held frame is still written if the context is done
+	if err := p.w.flush(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+	if err := p.enc.WriteTrailer(); err != nil {
+		return err
+	}
+	if err := p.enc.Flush(); err != nil {
+		return err
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+type pipelineResult struct {
+	f   *Frame
+	err error
+}
+
+// ahead prepares images on another goroutine, blocking once the buffer is full.
+func (p *Pipeline) ahead(ctx context.Context) func(context.Context) (*Frame, error) {
+	ch := make(chan pipelineResult, p.opts.Buffer)
+	go func() {
+		for {
+			f, err := p.next(ctx)
+			select {
+			case ch <- pipelineResult{f, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return func(ctx context.Context) (*Frame, error) {
+		select {
+		case r := <-ch:
+			return r.f, r.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// next reads the next image from the source and converts it to a paletted image that the
+// pipeline owns.
+func (p *Pipeline) next(ctx context.Context) (*Frame, error) {
+	m, delay, err := p.src.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pm, ok := m.(*image.Paletted)
+	if ok {
+		// the source may reuse the palette as well as the pixels
+		cp := image.NewPaletted(pm.Rect, append(color.Palette(nil), pm.Palette...))
+		for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+			copy(cp.Pix[cp.PixOffset(pm.Rect.Min.X, y):], pm.Pix[pm.PixOffset(pm.Rect.Min.X, y):pm.PixOffset(pm.Rect.Max.X, y)])
+		}
+		return &Frame{Image: cp, DelayTime: delay}, nil
+	}
+
+	if p.q == nil {
+		p.q = NewAnimationQuantizer(p.opts.NumColors)
+		p.q.Transparent = true
+	}
+	pm = p.q.Quantize(m)
+	if p.opts.Dither != nil {
+		// dither with the opaque entries, then restore the transparent pixels
+		ti := p.q.TransparentIndex()
+		dm := image.NewPaletted(pm.Rect, pm.Palette[:ti])
+		p.opts.Dither.Draw(dm, dm.Rect, m, dm.Rect.Min)
+		for i, c := range pm.Pix {
+			if c == ti {
+				dm.Pix[i] = ti
+			}
+		}
+		dm.Palette = pm.Palette
+		pm = dm
+	}
+	return &Frame{Image: pm, DelayTime: delay}, nil
+}
+
+// frame passes a prepared image through the remaining stages.
+func (p *Pipeline) frame(ctx context.Context, f *Frame) error {
+	if p.c == nil {
+		if err := p.start(f.Image); err != nil {
+			return err
+		}
+	} else if p.opts.MergeDuplicates && p.w.held != nil && sameImage(p.last, f.Image) {
+		p.w.held.DelayTime += f.DelayTime
+		return nil
+	}
+	p.last = f.Image
+
+	if p.opts.Live {
+		if err := p.loop(); err != nil {
+			return err
+		}
+		if err := p.w.write(ctx, p.c.Coalesce(&Frame{Image: f.Image, DelayTime: f.DelayTime, DisposalMethod: DisposalNone})); err != nil {
+			return err
+		}
+		return p.enc.Flush()
+	}
+	// every image is shown exactly as is, so the Coalescer only keeps the disposals needed
+	// to reveal transparency
+	cf := p.c.Coalesce(&Frame{Image: f.Image, DelayTime: f.DelayTime, DisposalMethod: DisposalBackground})
+	if p.w.held != nil {
+		// the first frame is about to be written and more are expected
+		if err := p.loop(); err != nil {
+			return err
+		}
+	}
+	return p.w.frame(ctx, cf)
+}
+
+// start writes the header based on the first image.
+func (p *Pipeline) start(pm *image.Paletted) error {
+	cfg := p.opts.Config
+	if cfg.Width == 0 && cfg.Height == 0 {
+		cfg.Width, cfg.Height = pm.Rect.Max.X, pm.Rect.Max.Y
+	}
+	p.c = NewCoalescer(cfg)
+	if p.opts.Live {
+		if cfg.ColorModel == nil {
+			cfg.ColorModel = pm.Palette
+			if p.w.fo != nil {
+				// frames are written with the transparent entry the optimizer adds
+				cfg.ColorModel, _ = p.w.fo.transparent(pm.Palette)
+			}
+		}
+		return p.enc.WriteHeader(cfg, 0)
+	}
+	if cfg.ColorModel == nil {
+		// choose a global color table once a few frames have been seen
+		return p.enc.WriteHeaderDeferred(&Header{Config: cfg}, 8)
+	}
+	return p.enc.WriteHeaderFrom(&Header{Config: cfg})
+}
+
+// loop writes the loop count once, before the first frame.
+func (p *Pipeline) loop() error {
+	if p.looped || p.opts.LoopCount < 0 {
+		return nil
+	}
+	p.looped = true
+	return p.enc.WriteApplicationNetscape(&ApplicationNetscape{LoopCount: p.opts.LoopCount})
+}
+
+// sameImage reports whether two compact paletted images are identical.
+func sameImage(pm0, pm1 *image.Paletted) bool {
+	return pm0.Rect.Eq(pm1.Rect) && samePalette(pm0.Palette, pm1.Palette) && bytes.Equal(pm0.Pix, pm1.Pix)
+}
@@ -0,0 +1,128 @@
+package gif
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	frame := func(x int) image.Image {
+		m := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		draw.Draw(m, image.Rect(x, 0, x+2, 2), image.NewUniform(red), image.Point{}, draw.Src)
+		return m
+	}
+	ms := []image.Image{frame(0), frame(0), frame(2), frame(2), frame(1)}
+
+	testCases := []struct {
+		name   string
+		opts   PipelineOptions
+		shown  []int // image shown by each frame
+		delays []int
+	}{
+		{"plain", PipelineOptions{}, []int{0, 1, 2, 3, 4}, []int{10, 10, 10, 10, 10}},
+		{"optimized", PipelineOptions{Optimize: true, MergeDuplicates: true}, []int{0, 2, 4}, []int{20, 20, 10}},
+		{"dithered", PipelineOptions{Dither: draw.FloydSteinberg, Buffer: 2}, []int{0, 1, 2, 3, 4}, []int{10, 10, 10, 10, 10}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			opts := tc.opts
+			if err := NewPipeline(NewEncoder(buf), ImageSlice(ms, 100*time.Millisecond), &opts).Run(context.Background()); err != nil {
+				t.Fatal("Run:", err)
+			}
+			g, err := DecodeAll(buf)
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			if g.Config.Width != 4 || g.Config.Height != 4 || g.LoopCount != 0 || len(g.Image) != len(tc.delays) {
+				t.Fatal("unexpected animation:", g.Config.Width, g.Config.Height, g.LoopCount, len(g.Image))
+			}
+			// each image replaces the last, so moving squares don't leave trails
+			c := Coalesce(g)
+			for i := range c.Image {
+				if c.Delay[i] != tc.delays[i] {
+					t.Fatalf("frame %d delay: got %d, want %d", i, c.Delay[i], tc.delays[i])
+				}
+				for y := 0; y < 4; y++ {
+					for x := 0; x < 4; x++ {
+						if c0, c1 := c.Image[i].At(x, y), ms[tc.shown[i]].At(x, y); colorKey(c0) != colorKey(c1) {
+							t.Fatalf("frame %d pixel %d,%d: got %v, want %v", i, x, y, c0, c1)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineLive(t *testing.T) {
+	p := color.Palette{black, white}
+	ch := make(chan *Frame)
+	go func() {
+		// each frame adds a white pixel
+		for _, pix := range [][]uint8{{1, 0, 0, 0, 0, 0}, {1, 1, 0, 0, 0, 0}, {1, 1, 0, 0, 1, 0}} {
+			pm := image.NewPaletted(image.Rect(0, 0, 3, 2), p)
+			copy(pm.Pix, pix)
+			ch <- &Frame{Image: pm, DelayTime: time.Second}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &flushCounter{}
+	calls, flushes := 0, 0
+	src := FrameSourceFunc(func(ctx context.Context) (image.Image, time.Duration, error) {
+		if calls > 0 && w.flushes == flushes {
+			t.Error("frame not flushed before reading the next image")
+		}
+		if calls++; calls == 4 {
+			// the client went away after three frames were sent
+			cancel()
+		}
+		flushes = w.flushes
+		return FrameChan(ch).Next(ctx)
+	})
+	err := NewPipeline(NewEncoder(w), src, &PipelineOptions{LoopCount: -1, Optimize: true, Live: true}).Run(ctx)
+	if err != context.Canceled {
+		t.Fatal("expected canceled, got", err)
+	}
+
+	g, err := DecodeAll(&w.Buffer)
+	if err != nil {
+		t.Fatal("DecodeAll:", err)
+	}
+	if len(g.Image) != 3 || g.LoopCount != -1 || g.Delay[2] != 100 {
+		t.Fatal("unexpected animation:", len(g.Image), g.LoopCount, g.Delay)
+	}
+	// optimized frames only hold the changed pixel
+	for i, want := range []image.Rectangle{image.Rect(0, 0, 3, 2), image.Rect(1, 0, 2, 1), image.Rect(1, 1, 2, 2)} {
+		if g.Image[i].Rect != want {
+			t.Fatalf("frame %d: got bounds %v, want %v", i, g.Image[i].Rect, want)
+		}
+	}
+}
+
+func TestPipelineEmpty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := NewPipeline(NewEncoder(buf), ImageSlice(nil, 0), nil).Run(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if buf.Len() != 0 {
+		t.Fatal("unexpected output:", buf.Len())
+	}
+}
+
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (w *flushCounter) Flush() error {
+	w.flushes++
+	return nil
+}
@@ -0,0 +1,50 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Render draws the text into its text grid using the built-in monospace bitmap font, scaled to
+// the character cell size. The text flows left to right and top to bottom one cell at a time,
+// with characters that don't fit in the grid ignored, as described by the GIF89a specification.
+// The returned image covers the text grid and uses the given palette, which should be the
+// global color table. The grid is filled with the background index and glyphs are drawn with
+// the foreground index. If either index is outside the palette, black and white are used.
+func (pt *PlainText) Render(p color.Palette) *image.Paletted {
+	fg, bg := pt.TextForegroundColorIndex, pt.TextBackgroundColorIndex
+	if int(fg) >= len(p) || int(bg) >= len(p) {
+		p = color.Palette{color.Black, color.White}
+		fg, bg = 1, 0
+	}
+
+	r := image.Rect(0, 0, int(pt.TextGridWidth), int(pt.TextGridHeight))
+	pm := image.NewPaletted(r.Add(image.Pt(int(pt.TextGridLeftPosition), int(pt.TextGridTopPosition))), p)
+	if bg != 0 {
+		for i := range pm.Pix {
+			pm.Pix[i] = bg
+		}
+	}
+
+	cw, ch := int(pt.CharacterCellWidth), int(pt.CharacterCellHeight)
+	if cw == 0 || ch == 0 {
+		return pm
+	}
+	cols, rows := r.Dx()/cw, r.Dy()/ch
+	for i, c := range []rune(strings.Join(pt.Strings, "")) {
+		if i >= cols*rows {
+			break
+		}
+		o := pm.Rect.Min.Add(image.Pt(i%cols*cw, i/cols*ch))
+		drawGlyph(pm, image.Rectangle{Min: o, Max: o.Add(image.Pt(cw, ch))}, c, fg)
+	}
+	return pm
+}
+
+// Frame returns the rendered text as a frame with the same delay time and disposal method, so
+// that it can be coalesced, optimized or encoded like any other image. This is also a way to
+// burn captions into an animation for viewers that ignore plain text extensions.
+func (pt *PlainText) Frame(p color.Palette) *Frame {
+	return &Frame{Image: pt.Render(p), DelayTime: pt.DelayTime, DisposalMethod: pt.DisposalMethod}
+}
@@ -0,0 +1,67 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestPlainTextRender(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	pt := &PlainText{
+		TextGridLeftPosition:     2,
+		TextGridTopPosition:      1,
+		TextGridWidth:            13,
+		TextGridHeight:           8,
+		CharacterCellWidth:       6,
+		CharacterCellHeight:      8,
+		TextForegroundColorIndex: 2,
+		TextBackgroundColorIndex: 1,
+		Strings:                  []string{"Hi", "!"},
+		DelayTime:                50 * time.Millisecond,
+		DisposalMethod:           DisposalBackground,
+	}
+
+	f := pt.Frame(color.Palette{black, white, red})
+	if f.DelayTime != pt.DelayTime || f.DisposalMethod != pt.DisposalMethod {
+		t.Fatal("unexpected frame:", f.DelayTime, f.DisposalMethod)
+	}
+	pm := f.Image
+	if pm.Rect != image.Rect(2, 1, 15, 9) {
+		t.Fatal("unexpected bounds:", pm.Rect)
+	}
+	testCases := []struct {
+		x, y int
+		want uint8
+	}{
+		{2, 1, 2},  // 'H' left stroke
+		{3, 1, 1},  // 'H' background
+		{6, 1, 2},  // 'H' right stroke
+		{3, 4, 2},  // 'H' crossbar
+		{7, 1, 1},  // gap between cells
+		{10, 1, 2}, // dot of 'i'
+		{10, 2, 1},
+		{14, 1, 1}, // '!' doesn't fit in the grid
+		{2, 8, 1},  // gap below glyphs
+	}
+	for _, tc := range testCases {
+		if got := pm.ColorIndexAt(tc.x, tc.y); got != tc.want {
+			t.Fatal("unexpected index at", tc.x, tc.y, "got:", got, "want:", tc.want)
+		}
+	}
+
+	// scaled to a larger cell
+	pt.CharacterCellWidth, pt.CharacterCellHeight = 12, 16
+	pt.TextGridWidth, pt.TextGridHeight = 12, 16
+	pm = pt.Render(color.Palette{black, white, red})
+	if pm.ColorIndexAt(2, 1) != 2 || pm.ColorIndexAt(3, 2) != 2 || pm.ColorIndexAt(4, 1) != 1 {
+		t.Fatal("glyph not scaled")
+	}
+
+	// indexes outside the palette fall back to black and white
+	pm = pt.Render(color.Palette{black})
+	if len(pm.Palette) != 2 || pm.ColorIndexAt(2, 1) != 1 || pm.ColorIndexAt(4, 1) != 0 {
+		t.Fatal("unexpected fallback rendering")
+	}
+}
@@ -0,0 +1,166 @@
+package gif
+
+import (
+	"fmt"
+	"io"
+)
+
+// Progress describes how far a decode or encode has got.
+type Progress struct {
+	Bytes       int64 // Bytes read or written so far.
+	Frames      int   // Frames read or written so far.
+	TotalBytes  int64 // Estimated total bytes, or zero if unknown.
+	TotalFrames int   // Estimated total frames, or zero if unknown.
+}
+
+// SetProgress arranges for fn to be called after each frame is read and once the trailer is
+// reached, or stops reporting if fn is nil. Bytes counts those consumed by the decoder, so
+// excludes any read ahead by buffering. The totals are passed through to each report, typically
+// from the file size and a prior CountFrames, and may be zero if unknown. Reporting doesn't
+// allocate, so ReadFrameInto remains allocation free.
+func (d *Decoder) SetProgress(fn func(Progress), totalBytes int64, totalFrames int) {
+	pr, ok := d.r.(*progressReader)
+	if fn == nil {
+		if ok {
+			d.r = pr.reader
+		}
+		return
+	}
+	if !ok {
+		pr = &progressReader{reader: d.r}
+		d.r = pr
+	}
+	pr.fn = fn
+	pr.p.TotalBytes = totalBytes
+	pr.p.TotalFrames = totalFrames
+}
+
+// reportProgress calls any progress callback, counting a frame if one was just read.
+func (d *Decoder) reportProgress(frame bool) {
+	var pr *progressReader
+	switch r := d.r.(type) {
+	case *progressReader:
+		pr = r
+	case *contextReader:
+		pr, _ = r.reader.(*progressReader)
+	}
+	if pr == nil {
+		return
+	}
+	if frame {
+		pr.p.Frames++
+	}
+	pr.fn(pr.p)
+}
+
+// SetProgress arranges for fn to be called after each frame is written and once the trailer
+// is written, or stops reporting if fn is nil. Bytes counts those passed to the underlying
+// writer, so excludes a header held back until the version or global color table is known,
+// and frames held back by WriteHeaderDeferred are only reported once written. The totals are
+// passed through to each report and may be zero if unknown.
+func (e *Encoder) SetProgress(fn func(Progress), totalBytes int64, totalFrames int) {
+	s := e.state()
+	if fn == nil {
+		if s.progress != nil && s.writer == writer(s.progress) {
+			s.writer = s.progress.writer
+			s.progress = nil
+		}
+		return
+	}
+	if s.progress == nil {
+		s.progress = &progressWriter{writer: s.writer}
+		s.writer = s.progress
+	}
+	s.progress.fn = fn
+	s.progress.p.TotalBytes = totalBytes
+	s.progress.p.TotalFrames = totalFrames
+}
+
+// reportProgress calls any progress callback, counting a frame if one was just written.
+func (e *Encoder) reportProgress(frame bool) {
+	s := e.state()
+	if s.progress == nil || e.err != nil {
+		return
+	}
+	if frame {
+		s.progress.p.Frames++
+	}
+	s.progress.fn(s.progress.p)
+}
+
+// progressReader counts the bytes read and holds the decoder's progress callback.
+type progressReader struct {
+	reader
+	fn func(Progress)
+	p  Progress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.p.Bytes += int64(n)
+	return n, err
+}
+
+func (r *progressReader) ReadByte() (byte, error) {
+	c, err := r.reader.ReadByte()
+	if err == nil {
+		r.p.Bytes++
+	}
+	return c, err
+}
+
+// progressWriter counts the bytes written and holds the encoder's progress callback.
+type progressWriter struct {
+	writer
+	fn func(Progress)
+	p  Progress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.p.Bytes += int64(n)
+	return n, err
+}
+
+func (w *progressWriter) WriteByte(c byte) error {
+	err := w.writer.WriteByte(c)
+	if err == nil {
+		w.p.Bytes++
+	}
+	return err
+}
+
+// CountFrames returns the number of frames in a GIF, skipping over image data without
+// decompressing it, as a cheap scan to estimate the total for progress reporting.
+func CountFrames(r io.Reader) (int, error) {
+	d := NewDecoder(r)
+	if _, err := d.ReadHeader(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		c, err := readByte(d.r)
+		if err != nil {
+			return n, fmt.Errorf("gif: reading block: %v", err)
+		}
+
+		switch c {
+		case sExtension:
+			if _, err := d.readExtension_(); err != nil {
+				return n, err
+			}
+
+		case sImageDescriptor:
+			if err := d.readImageDescriptor_(nil, true); err != nil {
+				return n, err
+			}
+			n++
+
+		case sTrailer:
+			return n, nil
+
+		default:
+			return n, fmt.Errorf("gif: unknown block type: 0x%.2x", c)
+		}
+	}
+}
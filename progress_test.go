@@ -0,0 +1,132 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func progressAnimation(frames int) *GIF {
+	p := color.Palette{black, white}
+	g := &GIF{Config: image.Config{Width: 16, Height: 16, ColorModel: p}}
+	for i := 0; i < frames; i++ {
+		pm := image.NewPaletted(image.Rect(0, 0, 16, 16), p)
+		pm.Pix[i] = 1
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, 10)
+		g.Disposal = append(g.Disposal, DisposalNone)
+	}
+	return g
+}
+
+func TestDecoderProgress(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := EncodeAll(buf, progressAnimation(5)); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	data := buf.Bytes()
+
+	n, err := CountFrames(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("CountFrames:", err)
+	}
+	if n != 5 {
+		t.Fatal("CountFrames: got", n, "want 5")
+	}
+
+	var got []Progress
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.SetProgress(func(p Progress) { got = append(got, p) }, int64(len(data)), n)
+	if _, err := dec.Decode(); err != nil {
+		t.Fatal("Decode:", err)
+	}
+	if len(got) != 6 {
+		t.Fatal("unexpected reports:", got)
+	}
+	for i, p := range got {
+		if p.Frames != min(i+1, 5) || p.TotalFrames != 5 || p.TotalBytes != int64(len(data)) {
+			t.Fatalf("report %d: unexpected progress %+v", i, p)
+		}
+		if i > 0 && p.Bytes <= got[i-1].Bytes {
+			t.Fatalf("report %d: bytes didn't increase: %+v", i, p)
+		}
+	}
+	if last := got[len(got)-1]; last.Bytes != int64(len(data)) {
+		t.Fatal("unexpected final bytes:", last.Bytes, "want", len(data))
+	}
+
+	// reporting doesn't allocate
+	dec = NewDecoder(bytes.NewReader(data))
+	if _, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	}
+	frames := 0
+	dec.SetProgress(func(p Progress) { frames = p.Frames }, 0, 0)
+	dst := &image.Paletted{}
+	if n := testing.AllocsPerRun(4, func() {
+		if _, err := dec.ReadFrameInto(dst); err != nil {
+			t.Fatal("ReadFrameInto:", err)
+		}
+	}); n > 0 {
+		t.Fatal("unexpected allocations:", n)
+	}
+	if frames != 5 {
+		t.Fatal("unexpected frames:", frames)
+	}
+	dec.SetProgress(nil, 0, 0)
+	if _, err := dec.ReadFrameInto(dst); err != io.EOF {
+		t.Fatal("expected EOF, got", err)
+	}
+	if frames != 5 {
+		t.Fatal("reported after removal:", frames)
+	}
+}
+
+func TestEncoderProgress(t *testing.T) {
+	g := progressAnimation(5)
+	for _, deferred := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		var got []Progress
+		enc.SetProgress(func(p Progress) { got = append(got, p) }, 0, len(g.Image))
+
+		hdr := &Header{Config: g.Config}
+		var err error
+		if deferred {
+			err = enc.WriteHeaderDeferred(hdr, len(g.Image))
+		} else {
+			err = enc.WriteHeaderFrom(hdr)
+		}
+		if err != nil {
+			t.Fatal("WriteHeader:", err)
+		}
+		for i, m := range g.Image {
+			if err := enc.WriteImageFrame(m, 0); err != nil {
+				t.Fatal("WriteImageFrame:", err)
+			}
+			if !deferred && (len(got) != i+1 || got[i].Frames != i+1) {
+				t.Fatalf("frame %d: unexpected reports %+v", i, got)
+			}
+		}
+		if err := enc.WriteTrailer(); err != nil {
+			t.Fatal("WriteTrailer:", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatal("Flush:", err)
+		}
+
+		if len(got) != 6 {
+			t.Fatal("unexpected reports:", got)
+		}
+		for i, p := range got {
+			if p.Frames != min(i+1, 5) || p.TotalFrames != 5 {
+				t.Fatalf("report %d: unexpected progress %+v", i, p)
+			}
+		}
+		if last := got[len(got)-1]; last.Bytes != int64(buf.Len()) {
+			t.Fatal("unexpected final bytes:", last.Bytes, "want", buf.Len())
+		}
+	}
+}
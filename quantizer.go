@@ -0,0 +1,304 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// NewAnimationQuantizer returns a new AnimationQuantizer producing palettes with at most
+// numColors entries.
+func NewAnimationQuantizer(numColors int) *AnimationQuantizer {
+	if numColors < 2 || 256 < numColors {
+		numColors = 256
+	}
+	return &AnimationQuantizer{
+		NumColors: numColors,
+		Threshold: 3 * 16 * 16,
+		Tolerance: 3 * 8 * 8,
+	}
+}
+
+// AnimationQuantizer converts a sequence of images to paletted frames while keeping palette
+// entries and pixel indexes stable between frames, which avoids flickering colors and allows
+// Optimizer to find unchanged pixels.
+type AnimationQuantizer struct {
+	NumColors int     // Maximum number of palette entries, including any transparent entry.
+	Threshold float64 // Squared RGB distance above which a color is poorly represented by the palette.
+	Tolerance float64 // Additional squared RGB distance accepted for a pixel to keep its previous palette index.
+
+	// Transparent reserves the last palette entry for pixels that are less than half opaque.
+	// Use TransparentIndex to initialize an Optimizer.
+	Transparent bool
+
+	pal  color.Palette // opaque entries
+	out  color.Palette // opaque entries followed by any transparent entry
+	prev *image.Paletted
+}
+
+// TransparentIndex returns the palette index reserved for transparent pixels.
+func (q *AnimationQuantizer) TransparentIndex() uint8 {
+	return uint8(q.NumColors - 1)
+}
+
+// Quantize returns the given image converted to a paletted image. The palette is updated only
+// when some colors exceed the error threshold, in which case the least used entries are
+// replaced. The same palette slice is returned for consecutive frames until it changes.
+func (q *AnimationQuantizer) Quantize(m image.Image) *image.Paletted {
+	src := toRGBA(m)
+	r := src.Rect
+	hist := newHistogram(src)
+
+	slots := q.NumColors
+	if q.Transparent {
+		slots--
+	}
+	if q.pal == nil {
+		q.pal = hist.medianCut(slots)
+		q.out = nil
+	} else if q.updatePalette(hist, slots) {
+		q.out = nil
+	}
+	if q.out == nil {
+		q.out = q.pal
+		if q.Transparent {
+			// q.pal keeps only the colors in use, so updatePalette can fill the free slots
+			q.out = make(color.Palette, q.NumColors)
+			copy(q.out, q.pal)
+			for i := len(q.pal); i < slots; i++ {
+				// pad so the transparent entry is always the last index
+				q.out[i] = color.RGBA{A: 0xff}
+			}
+			q.out[slots] = color.Transparent
+		}
+	}
+
+	pm := image.NewPaletted(r, q.out)
+	var prev []uint8
+	if q.prev != nil && q.prev.Rect.Eq(r) {
+		prev = q.prev.Pix
+	}
+	cache := make(map[uint32]uint8)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := src.PixOffset(r.Min.X, y)
+		j := pm.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := unpremultiply(src.Pix[i : i+4])
+			if src.Pix[i+3] < 0x80 && q.Transparent {
+				pm.Pix[j] = q.TransparentIndex()
+			} else {
+				key := uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+				idx, ok := cache[key]
+				if !ok {
+					idx = nearest(q.pal, c)
+					cache[key] = idx
+				}
+				if prev != nil && int(prev[j]) < len(q.pal) && prev[j] != idx &&
+					sqDiff(c, q.pal[prev[j]].(color.RGBA)) <= sqDiff(c, q.pal[idx].(color.RGBA))+q.Tolerance {
+					idx = prev[j]
+				}
+				pm.Pix[j] = idx
+			}
+			i += 4
+			j++
+		}
+	}
+
+	q.prev = pm
+	return pm
+}
+
+// updatePalette replaces the least used palette entries with colors that are poorly represented.
+func (q *AnimationQuantizer) updatePalette(hist histogram, slots int) bool {
+	usage := make([]int, len(q.pal))
+	var poor histogram
+	for _, b := range hist {
+		c := b.color()
+		i := nearest(q.pal, c)
+		if sqDiff(c, q.pal[i].(color.RGBA)) > q.Threshold {
+			poor = append(poor, b)
+		} else {
+			usage[i] += b.n
+		}
+	}
+	if len(poor) == 0 {
+		return false
+	}
+
+	free := slots - len(q.pal)
+	replace := len(q.pal) / 4
+	if replace < 1 {
+		replace = 1
+	}
+	candidates := poor.medianCut(free + replace)
+
+	pal := make(color.Palette, len(q.pal), slots)
+	copy(pal, q.pal)
+	for len(pal) < slots && len(candidates) > 0 {
+		pal = append(pal, candidates[0])
+		candidates = candidates[1:]
+	}
+	if len(candidates) > 0 {
+		order := make([]int, len(usage))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return usage[order[i]] < usage[order[j]] })
+		for i, c := range candidates {
+			pal[order[i]] = c
+		}
+	}
+	q.pal = pal
+	return true
+}
+
+func toRGBA(m image.Image) *image.RGBA {
+	if rgba, ok := m.(*image.RGBA); ok {
+		return rgba
+	}
+	b := m.Bounds()
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, m, b.Min, draw.Src)
+	return rgba
+}
+
+func unpremultiply(p []uint8) color.RGBA {
+	c := color.RGBA{R: p[0], G: p[1], B: p[2], A: p[3]}
+	if c.A != 0 && c.A != 0xff {
+		c.R = uint8(uint32(c.R) * 0xff / uint32(c.A))
+		c.G = uint8(uint32(c.G) * 0xff / uint32(c.A))
+		c.B = uint8(uint32(c.B) * 0xff / uint32(c.A))
+	}
+	c.A = 0xff
+	return c
+}
+
+func sqDiff(c0, c1 color.RGBA) float64 {
+	dr := float64(c0.R) - float64(c1.R)
+	dg := float64(c0.G) - float64(c1.G)
+	db := float64(c0.B) - float64(c1.B)
+	return dr*dr + dg*dg + db*db
+}
+
+func nearest(p color.Palette, c color.RGBA) uint8 {
+	best, bestDiff := 0, -1.0
+	for i, pc := range p {
+		if d := sqDiff(c, pc.(color.RGBA)); bestDiff < 0 || d < bestDiff {
+			best, bestDiff = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return uint8(best)
+}
+
+// bin accumulates the pixels falling in one cell of a 5-bit per channel color cube.
+type bin struct {
+	r, g, b, n int
+}
+
+func (b *bin) color() color.RGBA {
+	return color.RGBA{R: uint8(b.r / b.n), G: uint8(b.g / b.n), B: uint8(b.b / b.n), A: 0xff}
+}
+
+type histogram []*bin
+
+func newHistogram(m *image.RGBA) histogram {
+	bins := make(map[uint16]*bin)
+	var hist histogram
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		i := m.PixOffset(m.Rect.Min.X, y)
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			if m.Pix[i+3] >= 0x80 {
+				c := unpremultiply(m.Pix[i : i+4])
+				key := uint16(c.R>>3)<<10 | uint16(c.G>>3)<<5 | uint16(c.B>>3)
+				b := bins[key]
+				if b == nil {
+					b = &bin{}
+					bins[key] = b
+					hist = append(hist, b)
+				}
+				b.r += int(c.R)
+				b.g += int(c.G)
+				b.b += int(c.B)
+				b.n++
+			}
+			i += 4
+		}
+	}
+	return hist
+}
+
+// medianCut repeatedly splits the box with the widest channel range at its weighted median
+// until n boxes exist, then returns the average color of each box.
+func (h histogram) medianCut(n int) color.Palette {
+	if len(h) == 0 {
+		return color.Palette{color.RGBA{A: 0xff}}
+	}
+
+	boxes := []histogram{h}
+	for len(boxes) < n {
+		bi, ch, width := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				lo, hi := 0xff, 0
+				for _, b := range box {
+					v := b.channel(c)
+					lo = min(lo, v)
+					hi = max(hi, v)
+				}
+				if hi-lo > width {
+					bi, ch, width = i, c, hi-lo
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+
+		box := boxes[bi]
+		sort.Slice(box, func(i, j int) bool { return box[i].channel(ch) < box[j].channel(ch) })
+		total := 0
+		for _, b := range box {
+			total += b.n
+		}
+		split, acc := 1, 0
+		for i, b := range box[:len(box)-1] {
+			if acc += b.n; acc*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[bi] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		sum := bin{}
+		for _, b := range box {
+			sum.r += b.r
+			sum.g += b.g
+			sum.b += b.b
+			sum.n += b.n
+		}
+		p[i] = sum.color()
+	}
+	return p
+}
+
+func (b *bin) channel(c int) int {
+	switch c {
+	case 0:
+		return b.r / b.n
+	case 1:
+		return b.g / b.n
+	default:
+		return b.b / b.n
+	}
+}
@@ -0,0 +1,140 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestAnimationQuantizer(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(m.Pix); i += 4 {
+		v := uint8(rnd.Intn(0x100))
+		m.Pix[i+0], m.Pix[i+1], m.Pix[i+2], m.Pix[i+3] = v, 0xff-v, v/2, 0xff
+	}
+
+	q := NewAnimationQuantizer(16)
+	q.Transparent = true
+	pm0 := q.Quantize(m)
+	if len(pm0.Palette) != 16 {
+		t.Fatal("unexpected palette size: got:", len(pm0.Palette), "want:", 16)
+	}
+	if _, _, _, a := pm0.Palette[q.TransparentIndex()].RGBA(); a != 0 {
+		t.Fatal("transparent entry not reserved")
+	}
+
+	// add slight noise that should neither change the palette nor the pixel indexes
+	for i := 0; i < len(m.Pix); i += 4 {
+		m.Pix[i] ^= 1
+	}
+	m.Set(0, 0, color.Transparent)
+	pm1 := q.Quantize(m)
+	if &pm1.Palette[0] != &pm0.Palette[0] {
+		t.Fatal("palette changed")
+	}
+	if pm1.Pix[0] != q.TransparentIndex() {
+		t.Fatal("unexpected transparent pixel index: got:", pm1.Pix[0], "want:", q.TransparentIndex())
+	}
+	for i := 1; i < len(pm1.Pix); i++ {
+		if pm1.Pix[i] != pm0.Pix[i] {
+			t.Fatal("unexpected pixel", i, "index change: got:", pm1.Pix[i], "want:", pm0.Pix[i])
+		}
+	}
+
+	// introduce a new color that must replace an existing entry
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			m.Set(x, y, blue)
+		}
+	}
+	pm2 := q.Quantize(m)
+	if &pm2.Palette[0] == &pm1.Palette[0] {
+		t.Fatal("palette not updated")
+	}
+	if c := pm2.Palette[pm2.Pix[pm2.PixOffset(1, 1)]]; sqDiff(c.(color.RGBA), blue) > q.Threshold {
+		t.Fatal("new color poorly represented:", c)
+	}
+
+	changed := 0
+	for i := range pm2.Pix {
+		if pm2.Pix[i] != pm1.Pix[i] {
+			changed++
+		}
+	}
+	if changed > len(pm2.Pix)/8 {
+		t.Fatal("too many pixel index changes:", changed)
+	}
+}
+
+func TestAnimationQuantizerOptimize(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	green := color.RGBA{G: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	halves := func(left, right color.RGBA) *image.RGBA {
+		m := image.NewRGBA(image.Rect(0, 0, 4, 2))
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 4; x++ {
+				if x < 2 {
+					m.SetRGBA(x, y, left)
+				} else {
+					m.SetRGBA(x, y, right)
+				}
+			}
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name      string
+		numColors int
+		reused    bool // whether the new color replaces the entry of the color it supersedes
+	}{
+		{"free", 4, false},
+		{"replaced", 3, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewAnimationQuantizer(tc.numColors)
+			q.Transparent = true
+			o := NewOptimizer(q.TransparentIndex())
+			src := []*image.RGBA{halves(red, green), halves(red, blue)}
+			g := &GIF{Delay: make([]int, len(src))}
+			for _, m := range src {
+				pm, err := o.Optimize(q.Quantize(m))
+				if err != nil {
+					t.Fatal("Optimize:", err)
+				}
+				g.Image = append(g.Image, pm)
+			}
+			want := uint8(2)
+			if tc.reused {
+				want = g.Image[0].Pix[g.Image[0].PixOffset(3, 0)]
+			}
+			if i := g.Image[1].Pix[g.Image[1].PixOffset(3, 0)]; i != want {
+				t.Fatal("unexpected new color index: got:", i, "want:", want)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := EncodeAll(buf, g); err != nil {
+				t.Fatal("EncodeAll:", err)
+			}
+			got, err := DecodeAll(buf)
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			for i, pm := range Coalesce(got).Image {
+				for y := 0; y < 2; y++ {
+					for x := 0; x < 4; x++ {
+						if c := color.RGBAModel.Convert(pm.At(x, y)); c != src[i].At(x, y) {
+							t.Fatal("frame", i, "pixel", x, y, "color: got:", c, "want:", src[i].At(x, y))
+						}
+					}
+				}
+			}
+		})
+	}
+}
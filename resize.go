@@ -0,0 +1,257 @@
+package gif
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Filter is an interpolation method used when resizing.
+type Filter int
+
+const (
+	NearestNeighbor Filter = iota // Fastest, but blocky.
+	Bilinear                      // Smooth, with some blurring when downscaling heavily.
+	CatmullRom                    // Sharpest, slowest.
+)
+
+func (f Filter) kernel() (float64, func(float64) float64) {
+	switch f {
+	case Bilinear:
+		return 1, func(t float64) float64 {
+			if t < 0 {
+				t = -t
+			}
+			if t < 1 {
+				return 1 - t
+			}
+			return 0
+		}
+	case CatmullRom:
+		return 2, func(t float64) float64 {
+			if t < 0 {
+				t = -t
+			}
+			if t < 1 {
+				return (3*t*t*t - 5*t*t + 2) / 2
+			}
+			if t < 2 {
+				return (-t*t*t + 5*t*t - 8*t + 4) / 2
+			}
+			return 0
+		}
+	}
+	return 0, nil
+}
+
+// Resize returns a copy of the given GIF scaled to the given logical screen size. Frames are
+// coalesced, scaled with the given filter, mapped back onto their original palettes and then
+// re-optimized. Use ResizeDisplay to correct for non-square pixels.
+func Resize(g *GIF, width, height int, f Filter) (*GIF, error) {
+	if width < 1 || height < 1 || width > math.MaxUint16 || height > math.MaxUint16 {
+		return nil, errors.New("gif: invalid resize dimensions")
+	}
+
+	c := Coalesce(g)
+	c.Config.Width = width
+	c.Config.Height = height
+	for i, pm := range c.Image {
+		c.Image[i] = resizePaletted(pm, width, height, f)
+	}
+	OptimizeCoalesced(c)
+	return c, nil
+}
+
+// ResizeDisplay is like Resize, but corrects for the pixel aspect ratio of the given header,
+// typically the one the GIF was decoded with. A zero width or height is chosen to keep the
+// proportions of Header.DisplaySize, and both zero resize to the display size itself, so the
+// result appears as intended with square pixels.
+func ResizeDisplay(g *GIF, hdr *Header, width, height int, f Filter) (*GIF, error) {
+	ds := hdr.DisplaySize()
+	switch {
+	case width == 0 && height == 0:
+		width, height = ds.X, ds.Y
+	case width == 0 && ds.Y > 0:
+		width = max(int(math.Round(float64(height*ds.X)/float64(ds.Y))), 1)
+	case height == 0 && ds.X > 0:
+		height = max(int(math.Round(float64(width*ds.Y)/float64(ds.X))), 1)
+	}
+	return Resize(g, width, height, f)
+}
+
+// NewResizer returns a new Resizer for frames on the logical screen described by the given
+// config, producing frames of the given size.
+func NewResizer(cfg image.Config, width, height int, f Filter) *Resizer {
+	return &Resizer{c: NewCoalescer(cfg), width: width, height: height, f: f}
+}
+
+// Resizer is the streaming equivalent of Resize. It returns full logical screen frames that
+// are not optimized, so they are typically passed through an Optimizer before encoding.
+// The same one frame delay as Coalescer applies.
+type Resizer struct {
+	c             *Coalescer
+	width, height int
+	f             Filter
+	in, out       *Frame
+}
+
+// Resize coalesces the given frame and returns it scaled to the configured size.
+func (r *Resizer) Resize(f *Frame) *Frame {
+	in := r.c.Coalesce(f)
+	if r.out != nil {
+		r.out.DisposalMethod = r.in.DisposalMethod
+	}
+	r.in = in
+	r.out = &Frame{
+		Image:          resizePaletted(in.Image, r.width, r.height, r.f),
+		DelayTime:      in.DelayTime,
+		DisposalMethod: in.DisposalMethod,
+	}
+	return r.out
+}
+
+// resizePaletted scales the given image and maps the result back onto its palette.
+func resizePaletted(pm *image.Paletted, width, height int, f Filter) *image.Paletted {
+	src := image.NewRGBA(pm.Rect)
+	draw.Draw(src, src.Rect, pm, pm.Rect.Min, draw.Src)
+	return toPalette(scale(src, width, height, f), pm.Palette)
+}
+
+// scale resamples the given premultiplied image to the given size using a separable filter.
+func scale(src *image.RGBA, width, height int, f Filter) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+
+	support, at := f.kernel()
+	if at == nil {
+		for y := 0; y < height; y++ {
+			sy := src.Rect.Min.Y + (2*y+1)*sh/(2*height)
+			for x := 0; x < width; x++ {
+				sx := src.Rect.Min.X + (2*x+1)*sw/(2*width)
+				i := src.PixOffset(sx, sy)
+				copy(dst.Pix[dst.PixOffset(x, y):], src.Pix[i:i+4])
+			}
+		}
+		return dst
+	}
+
+	xw := weights(sw, width, support, at)
+	yw := weights(sh, height, support, at)
+	tmp := make([]float64, 4*width*sh)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y):]
+		for x, ws := range xw {
+			t := tmp[4*(y*width+x):]
+			for _, w := range ws {
+				p := row[4*w.i:]
+				for c := 0; c < 4; c++ {
+					t[c] += w.w * float64(p[c])
+				}
+			}
+		}
+	}
+	for y, ws := range yw {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for _, w := range ws {
+				t := tmp[4*(w.i*width+x):]
+				for c := 0; c < 4; c++ {
+					sum[c] += w.w * t[c]
+				}
+			}
+			p := dst.Pix[dst.PixOffset(x, y):]
+			a := clamp(sum[3], 0xff)
+			for c := 0; c < 3; c++ {
+				// premultiplied color can't exceed alpha
+				p[c] = uint8(clamp(sum[c], a))
+			}
+			p[3] = uint8(a)
+		}
+	}
+	return dst
+}
+
+type weight struct {
+	i int
+	w float64
+}
+
+// weights returns the normalized source contributions for each destination index.
+func weights(srcLen, dstLen int, support float64, at func(float64) float64) [][]weight {
+	ratio := float64(srcLen) / float64(dstLen)
+	s := math.Max(ratio, 1)
+	ws := make([][]weight, dstLen)
+	for d := range ws {
+		center := (float64(d)+0.5)*ratio - 0.5
+		lo := int(math.Ceil(center - support*s))
+		hi := int(math.Floor(center + support*s))
+		var sum float64
+		for i := lo; i <= hi; i++ {
+			if w := at((float64(i) - center) / s); w != 0 {
+				ws[d] = append(ws[d], weight{min(max(i, 0), srcLen-1), w})
+				sum += w
+			}
+		}
+		if sum == 0 {
+			ws[d] = []weight{{min(max(int(math.Round(center)), 0), srcLen-1), 1}}
+			continue
+		}
+		for i := range ws[d] {
+			ws[d][i].w /= sum
+		}
+	}
+	return ws
+}
+
+func clamp(v, hi float64) float64 {
+	return math.Round(math.Min(math.Max(v, 0), hi))
+}
+
+// toPalette maps each pixel of the given image onto its nearest palette entry. Pixels that are
+// less than half opaque use a transparent entry, which is added to the palette if necessary.
+// A full palette without a transparent entry is copied with one entry given up, see
+// withTransparent.
+func toPalette(m *image.RGBA, p color.Palette) *image.Paletted {
+	for i := 3; i < len(m.Pix); i += 4 {
+		if m.Pix[i] < 0x80 {
+			p, _ = withTransparent(p)
+			break
+		}
+	}
+
+	dst := image.NewPaletted(m.Rect, p)
+	ti := findTransparent(p)
+	opaque := make(color.Palette, 0, len(p))
+	indexes := make([]uint8, 0, len(p))
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a != 0 {
+			opaque = append(opaque, c)
+			indexes = append(indexes, uint8(i))
+		}
+	}
+
+	cache := make(map[uint32]uint8)
+	for i, j := 0, 0; i < len(m.Pix); i, j = i+4, j+1 {
+		if m.Pix[i+3] < 0x80 || len(opaque) == 0 {
+			if ti < 0 {
+				dst.Palette, ti = withTransparent(dst.Palette)
+			}
+			dst.Pix[j] = uint8(ti)
+			continue
+		}
+		c := unpremultiply(m.Pix[i : i+4])
+		key := uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+		idx, ok := cache[key]
+		if !ok {
+			idx = indexes[opaque.Index(c)]
+			cache[key] = idx
+		}
+		dst.Pix[j] = idx
+	}
+	return dst
+}
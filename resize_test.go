@@ -0,0 +1,125 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	gp := color.Palette{black, white, red, color.Transparent}
+	pm0 := image.NewPaletted(image.Rect(0, 0, 4, 4), gp)
+	for i := range pm0.Pix {
+		pm0.Pix[i] = uint8(i / 8) // top half black, bottom half white
+	}
+	pm0.Pix[0] = 3
+	pm1 := image.NewPaletted(image.Rect(2, 0, 4, 2), gp)
+	for i := range pm1.Pix {
+		pm1.Pix[i] = 2
+	}
+	g := &GIF{
+		Image:  []*image.Paletted{pm0, pm1},
+		Delay:  []int{10, 20},
+		Config: image.Config{Width: 4, Height: 4, ColorModel: gp},
+	}
+
+	for _, f := range []Filter{NearestNeighbor, Bilinear, CatmullRom} {
+		for _, size := range []int{2, 8} {
+			r, err := Resize(g, size, size, f)
+			if err != nil {
+				t.Fatal("Resize:", err)
+			}
+			if r.Config.Width != size || r.Config.Height != size {
+				t.Fatal("unexpected size:", r.Config.Width, r.Config.Height)
+			}
+			buf := &bytes.Buffer{}
+			if err := EncodeAll(buf, r); err != nil {
+				t.Fatal("EncodeAll:", err)
+			}
+			d, err := DecodeAll(buf)
+			if err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+			c := Coalesce(d)
+			for _, tc := range []struct {
+				frame int
+				x, y  int
+				want  color.Color
+			}{
+				{0, size - 1, 0, black},
+				{0, size - 1, size - 1, white},
+				{1, size - 1, 0, red},
+				{1, 0, size - 1, white},
+			} {
+				if got := c.Image[tc.frame].At(tc.x, tc.y); colorKey(got) != colorKey(tc.want) {
+					t.Fatal("filter", f, "size", size, "frame", tc.frame, "unexpected pixel", tc.x, tc.y, "got:", got, "want:", tc.want)
+				}
+			}
+			if size == 8 {
+				if _, _, _, a := c.Image[0].At(0, 0).RGBA(); a != 0 && f == NearestNeighbor {
+					t.Fatal("transparency not preserved")
+				}
+			}
+		}
+	}
+}
+
+func TestResizeDisplay(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{black, white})
+	g := &GIF{Image: []*image.Paletted{pm}, Delay: []int{0}, Config: image.Config{Width: 4, Height: 4}}
+	// pixels twice as wide as they are tall
+	hdr := &Header{Config: g.Config, AspectRatio: 113}
+
+	for _, tc := range []struct {
+		width, height int
+		want          image.Point
+	}{
+		{0, 0, image.Pt(8, 4)},
+		{0, 2, image.Pt(4, 2)},
+		{16, 0, image.Pt(16, 8)},
+		{3, 3, image.Pt(3, 3)},
+	} {
+		r, err := ResizeDisplay(g, hdr, tc.width, tc.height, NearestNeighbor)
+		if err != nil {
+			t.Fatal("ResizeDisplay:", err)
+		}
+		if got := image.Pt(r.Config.Width, r.Config.Height); got != tc.want {
+			t.Fatal("unexpected size:", got, "want:", tc.want)
+		}
+	}
+}
+
+func TestResizer(t *testing.T) {
+	gp := color.Palette{black, white}
+	pm := image.NewPaletted(image.Rect(0, 0, 2, 2), gp)
+	copy(pm.Pix, []uint8{0, 1, 1, 0})
+	r := NewResizer(image.Config{Width: 2, Height: 2}, 4, 4, NearestNeighbor)
+	f := r.Resize(&Frame{Image: pm, DelayTime: 100})
+	if f.Image.Rect != image.Rect(0, 0, 4, 4) || f.DelayTime != 100 || f.DisposalMethod != DisposalNone {
+		t.Fatal("unexpected frame:", f.Image.Rect, f.DelayTime, f.DisposalMethod)
+	}
+	if f.Image.At(3, 0) != white || f.Image.At(3, 3) != black {
+		t.Fatal("unexpected pixels:", f.Image.Pix)
+	}
+}
+
+func TestToPaletteFull(t *testing.T) {
+	gp := make(color.Palette, 256)
+	for i := range gp {
+		gp[i] = color.Gray{Y: uint8(i)}
+	}
+	m := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	m.Set(1, 0, color.Gray{Y: 200})
+	pm := toPalette(m, gp)
+	if _, _, _, a := pm.At(0, 0).RGBA(); a != 0 {
+		t.Fatal("transparent pixel painted opaque:", pm.At(0, 0))
+	}
+	if got := pm.At(1, 0); colorKey(got) != colorKey(color.Gray{Y: 200}) {
+		t.Fatal("unexpected opaque pixel:", got)
+	}
+	if gp[1] != (color.Gray{Y: 1}) {
+		t.Fatal("source palette modified")
+	}
+}
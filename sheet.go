@@ -0,0 +1,278 @@
+package gif
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"time"
+)
+
+// SheetOptions are the parameters for SpriteSheet.
+type SheetOptions struct {
+	// Packed trims each frame to the bounds of its visible pixels and packs the distinct
+	// results into a tight atlas, rather than placing whole frames on a grid.
+	Packed bool
+	// Columns is the number of grid columns, or zero for a roughly square grid. It is ignored
+	// when packing.
+	Columns int
+	// Padding is the number of transparent pixels between frames.
+	Padding int
+}
+
+// SheetManifest describes where each frame of an animation is stored on a sprite sheet.
+type SheetManifest struct {
+	Width     int          `json:"width"`  // Frame width, the logical screen width of the animation.
+	Height    int          `json:"height"` // Frame height, the logical screen height of the animation.
+	LoopCount int          `json:"loopCount"`
+	Frames    []SheetFrame `json:"frames"`
+}
+
+// SheetFrame is the area of a sprite sheet holding one frame, along with where that area is
+// drawn within the frame. Pixels of the frame outside the area are transparent.
+type SheetFrame struct {
+	X        int `json:"x"`
+	Y        int `json:"y"`
+	Width    int `json:"w"`
+	Height   int `json:"h"`
+	OffsetX  int `json:"offsetX,omitempty"`
+	OffsetY  int `json:"offsetY,omitempty"`
+	Duration int `json:"duration"` // Milliseconds.
+}
+
+// SpriteSheet composites each frame of the given GIF and packs them into a single image with a
+// manifest of frame areas and durations. The sheet shares the colors of the animation, combined
+// into one palette, unless there are more than 256 of them across frames, in which case the
+// frames are quantized together.
+func SpriteSheet(g *GIF, opts *SheetOptions) (*image.Paletted, *SheetManifest, error) {
+	if len(g.Image) == 0 {
+		return nil, nil, errors.New("gif: missing image data")
+	}
+	if opts == nil {
+		opts = &SheetOptions{}
+	}
+	if opts.Padding < 0 || opts.Columns < 0 {
+		return nil, nil, errors.New("gif: invalid sprite sheet options")
+	}
+
+	c := Coalesce(g)
+	frames, p := sheetFrames(c.Image)
+	ti := -1
+	for i, col := range p {
+		if _, _, _, a := col.RGBA(); a == 0 {
+			ti = i
+			break
+		}
+	}
+
+	sm := &SheetManifest{Width: c.Config.Width, Height: c.Config.Height, LoopCount: c.LoopCount, Frames: make([]SheetFrame, len(frames))}
+	for i := range sm.Frames {
+		if i < len(c.Delay) {
+			sm.Frames[i].Duration = c.Delay[i] * 10
+		}
+	}
+	var rects []image.Rectangle // area of each frame drawn on the sheet
+	var size image.Point
+	if opts.Packed {
+		rects, size = packSheet(frames, ti, opts.Padding, sm.Frames)
+	} else {
+		rects, size = gridSheet(len(frames), sm.Width, sm.Height, opts, sm.Frames)
+	}
+
+	sheet := image.NewPaletted(image.Rectangle{Max: size}, p)
+	if ti > 0 {
+		for i := range sheet.Pix {
+			sheet.Pix[i] = uint8(ti)
+		}
+	}
+	for i, sf := range sm.Frames {
+		src := rects[i]
+		for y := 0; y < src.Dy(); y++ {
+			j := frames[i].PixOffset(src.Min.X, src.Min.Y+y)
+			copy(sheet.Pix[sheet.PixOffset(sf.X, sf.Y+y):], frames[i].Pix[j:j+src.Dx()])
+		}
+	}
+	return sheet, sm, nil
+}
+
+// sheetFrames returns the given full frames converted to a common palette.
+func sheetFrames(pms []*image.Paletted) ([]*image.Paletted, color.Palette) {
+	frames := make([]*image.Paletted, len(pms))
+	if p := unionPalette(pms); p != nil {
+		if _, ok := paletteKeys(p)[transparentKey]; !ok && len(p) < 256 {
+			p = append(p, color.Transparent)
+		}
+		keys := paletteKeys(p)
+		for i, pm := range pms {
+			frames[i] = remapPalette(pm, p, keys)
+		}
+		return frames, p
+	}
+
+	// stack the frames and quantize them as a single image
+	r := pms[0].Rect
+	strip := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()*len(pms)))
+	for i, pm := range pms {
+		draw.Draw(strip, r.Sub(r.Min).Add(image.Pt(0, r.Dy()*i)), pm, r.Min, draw.Src)
+	}
+	q := NewAnimationQuantizer(256)
+	q.Transparent = true
+	qm := q.Quantize(strip)
+	for i := range pms {
+		sub := qm.SubImage(image.Rect(0, r.Dy()*i, r.Dx(), r.Dy()*(i+1))).(*image.Paletted)
+		sub.Rect = sub.Rect.Sub(sub.Rect.Min).Add(r.Min)
+		frames[i] = sub
+	}
+	return frames, qm.Palette
+}
+
+// gridSheet places whole frames in rows of the given number of columns, returning the source
+// area of each frame and the sheet size.
+func gridSheet(n, width, height int, opts *SheetOptions, sfs []SheetFrame) ([]image.Rectangle, image.Point) {
+	cols := opts.Columns
+	if cols == 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	cols = min(cols, n)
+	rows := (n + cols - 1) / cols
+	rects := make([]image.Rectangle, n)
+	for i := range sfs {
+		sfs[i].X = i % cols * (width + opts.Padding)
+		sfs[i].Y = i / cols * (height + opts.Padding)
+		sfs[i].Width, sfs[i].Height = width, height
+		rects[i] = image.Rect(0, 0, width, height)
+	}
+	return rects, image.Pt(cols*(width+opts.Padding)-opts.Padding, rows*(height+opts.Padding)-opts.Padding)
+}
+
+// packSheet trims each frame to its visible pixels and packs the distinct results onto
+// shelves, returning the source area of each frame and the sheet size.
+func packSheet(frames []*image.Paletted, ti, padding int, sfs []SheetFrame) ([]image.Rectangle, image.Point) {
+	rects := make([]image.Rectangle, len(frames))
+	same := make([]int, len(frames)) // earlier frame with the same trimmed pixels
+	seen := make(map[string]int)
+	var sprites []int // frames whose trimmed pixels are stored
+	area, widest := 0, 0
+	for i, pm := range frames {
+		same[i] = i
+		r := pm.Rect
+		if ti >= 0 {
+			r = opaqueBounds(pm, uint8(ti))
+		}
+		rects[i] = r
+		sfs[i].OffsetX, sfs[i].OffsetY = r.Min.X, r.Min.Y
+		sfs[i].Width, sfs[i].Height = r.Dx(), r.Dy()
+		if r.Empty() {
+			continue
+		}
+
+		key := make([]byte, 0, 4+r.Dx()*r.Dy())
+		key = append(key, byte(r.Dx()), byte(r.Dx()>>8), byte(r.Dy()), byte(r.Dy()>>8))
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			j := pm.PixOffset(r.Min.X, y)
+			key = append(key, pm.Pix[j:j+r.Dx()]...)
+		}
+		if j, ok := seen[string(key)]; ok {
+			same[i] = j
+			continue
+		}
+		seen[string(key)] = i
+		sprites = append(sprites, i)
+		area += (r.Dx() + padding) * (r.Dy() + padding)
+		widest = max(widest, r.Dx())
+	}
+
+	// tallest first onto shelves of a width that makes the sheet roughly square
+	sort.SliceStable(sprites, func(a, b int) bool { return rects[sprites[a]].Dy() > rects[sprites[b]].Dy() })
+	limit := max(widest, int(math.Ceil(math.Sqrt(float64(area))))-padding)
+	var size image.Point
+	x, y, shelf := 0, 0, 0
+	for _, i := range sprites {
+		r := rects[i]
+		if x > 0 && x+r.Dx() > limit {
+			x, y, shelf = 0, y+shelf+padding, 0
+		}
+		sfs[i].X, sfs[i].Y = x, y
+		size.X = max(size.X, x+r.Dx())
+		size.Y = max(size.Y, y+r.Dy())
+		x += r.Dx() + padding
+		shelf = max(shelf, r.Dy())
+	}
+	for i, j := range same {
+		sfs[i].X, sfs[i].Y = sfs[j].X, sfs[j].Y
+	}
+	return rects, size
+}
+
+// opaqueBounds returns the smallest rectangle containing every pixel other than the given
+// transparent index.
+func opaqueBounds(pm *image.Paletted, ti uint8) image.Rectangle {
+	var r image.Rectangle
+	for y := pm.Rect.Min.Y; y < pm.Rect.Max.Y; y++ {
+		i := pm.PixOffset(pm.Rect.Min.X, y)
+		for x, c := range pm.Pix[i : i+pm.Rect.Dx()] {
+			if c != ti {
+				r = r.Union(image.Rect(pm.Rect.Min.X+x, y, pm.Rect.Min.X+x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// FromSpriteSheet builds an animation from the areas of a sprite sheet described by the given
+// manifest. A paletted sheet keeps its palette, while other sheets are quantized. Frames are
+// then optimized so that each only stores what changed.
+func FromSpriteSheet(sheet image.Image, sm *SheetManifest) (*GIF, error) {
+	if len(sm.Frames) == 0 {
+		return nil, errors.New("gif: missing image data")
+	}
+	if sm.Width < 1 || sm.Height < 1 || sm.Width > math.MaxUint16 || sm.Height > math.MaxUint16 {
+		return nil, errors.New("gif: invalid sprite sheet dimensions")
+	}
+	pm, ok := sheet.(*image.Paletted)
+	if !ok {
+		q := NewAnimationQuantizer(256)
+		q.Transparent = true
+		pm = q.Quantize(sheet)
+	}
+
+	p := pm.Palette
+	ti, ok := paletteKeys(p)[transparentKey]
+	if !ok && len(p) < 256 {
+		ti = uint8(len(p))
+		p = append(p[:len(p):len(p)], color.Transparent)
+	}
+
+	screen := image.Rect(0, 0, sm.Width, sm.Height)
+	g := &GIF{
+		LoopCount: sm.LoopCount,
+		Config:    image.Config{Width: sm.Width, Height: sm.Height, ColorModel: p},
+	}
+	for _, sf := range sm.Frames {
+		if sf.Width < 0 || sf.Height < 0 {
+			return nil, errors.New("gif: invalid sprite sheet frame")
+		}
+		frame := image.NewPaletted(screen, p)
+		if ti != 0 {
+			for i := range frame.Pix {
+				frame.Pix[i] = ti
+			}
+		}
+		src := image.Rect(sf.X, sf.Y, sf.X+sf.Width, sf.Y+sf.Height).Add(pm.Rect.Min)
+		dst := src.Sub(src.Min).Add(image.Pt(sf.OffsetX, sf.OffsetY))
+		vis := dst.Intersect(screen).Intersect(pm.Rect.Sub(src.Min).Add(dst.Min))
+		for y := vis.Min.Y; y < vis.Max.Y; y++ {
+			i := pm.PixOffset(src.Min.X+vis.Min.X-dst.Min.X, src.Min.Y+y-dst.Min.Y)
+			copy(frame.Pix[frame.PixOffset(vis.Min.X, y):], pm.Pix[i:i+vis.Dx()])
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, int((time.Duration(sf.Duration)*time.Millisecond).Round(10*time.Millisecond)/(10*time.Millisecond)))
+		g.Disposal = append(g.Disposal, DisposalBackground)
+	}
+
+	out := Coalesce(g)
+	OptimizeCoalesced(out)
+	return out, nil
+}
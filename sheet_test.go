@@ -0,0 +1,127 @@
+package gif
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSpriteSheet(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	p0 := color.Palette{black, white, color.RGBA{}}
+	p1 := color.Palette{red, color.RGBA{}}
+	f0 := image.NewPaletted(image.Rect(0, 0, 4, 3), p0)
+	for i := range f0.Pix {
+		f0.Pix[i] = 2
+	}
+	f0.Pix[f0.PixOffset(1, 1)] = 0
+	f0.Pix[f0.PixOffset(2, 1)] = 1
+	f1 := image.NewPaletted(image.Rect(3, 2, 4, 3), p1)
+	f2 := image.NewPaletted(image.Rect(0, 0, 4, 3), p0)
+	copy(f2.Pix, f0.Pix)
+	g := &GIF{
+		Image:     []*image.Paletted{f0, f1, f2},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{DisposalNone, DisposalBackground, DisposalNone},
+		LoopCount: 3,
+		Config:    image.Config{Width: 4, Height: 3, ColorModel: p0},
+	}
+
+	testCases := []struct {
+		name   string
+		opts   SheetOptions
+		size   image.Point
+		frames []SheetFrame
+	}{
+		{"grid", SheetOptions{}, image.Pt(8, 6), []SheetFrame{
+			{X: 0, Y: 0, Width: 4, Height: 3, Duration: 100},
+			{X: 4, Y: 0, Width: 4, Height: 3, Duration: 200},
+			{X: 0, Y: 3, Width: 4, Height: 3, Duration: 300},
+		}},
+		{"columns", SheetOptions{Columns: 3, Padding: 1}, image.Pt(14, 3), []SheetFrame{
+			{X: 0, Y: 0, Width: 4, Height: 3, Duration: 100},
+			{X: 5, Y: 0, Width: 4, Height: 3, Duration: 200},
+			{X: 10, Y: 0, Width: 4, Height: 3, Duration: 300},
+		}},
+		{"packed", SheetOptions{Packed: true}, image.Pt(3, 3), []SheetFrame{
+			{X: 0, Y: 2, Width: 2, Height: 1, OffsetX: 1, OffsetY: 1, Duration: 100},
+			{X: 0, Y: 0, Width: 3, Height: 2, OffsetX: 1, OffsetY: 1, Duration: 200},
+			{X: 0, Y: 2, Width: 2, Height: 1, OffsetX: 1, OffsetY: 1, Duration: 300},
+		}},
+	}
+	want := Coalesce(g)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sheet, sm, err := SpriteSheet(g, &tc.opts)
+			if err != nil {
+				t.Fatal("SpriteSheet:", err)
+			}
+			if sheet.Rect.Size() != tc.size {
+				t.Fatal("unexpected sheet size:", sheet.Rect.Size())
+			}
+			if sm.Width != 4 || sm.Height != 3 || sm.LoopCount != 3 || len(sm.Frames) != len(tc.frames) {
+				t.Fatalf("unexpected manifest: %+v", sm)
+			}
+			for i, sf := range tc.frames {
+				if sm.Frames[i] != sf {
+					t.Fatalf("frame %d: got %+v, want %+v", i, sm.Frames[i], sf)
+				}
+			}
+
+			data, err := json.Marshal(sm)
+			if err != nil {
+				t.Fatal("Marshal:", err)
+			}
+			sm = &SheetManifest{}
+			if err := json.Unmarshal(data, sm); err != nil {
+				t.Fatal("Unmarshal:", err)
+			}
+			got, err := FromSpriteSheet(sheet, sm)
+			if err != nil {
+				t.Fatal("FromSpriteSheet:", err)
+			}
+			if got.LoopCount != g.LoopCount || len(got.Image) != len(g.Image) {
+				t.Fatal("unexpected animation:", got.LoopCount, len(got.Image))
+			}
+			have := Coalesce(got)
+			for i := range want.Image {
+				if have.Delay[i] != want.Delay[i] {
+					t.Fatalf("frame %d delay: got %d, want %d", i, have.Delay[i], want.Delay[i])
+				}
+				for y := 0; y < 3; y++ {
+					for x := 0; x < 4; x++ {
+						if c0, c1 := have.Image[i].At(x, y), want.Image[i].At(x, y); colorKey(c0) != colorKey(c1) {
+							t.Fatalf("frame %d pixel %d,%d: got %v, want %v", i, x, y, c0, c1)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFromSpriteSheetQuantized(t *testing.T) {
+	green := color.RGBA{G: 0xff, A: 0xff}
+	sheet := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	sheet.Set(0, 0, green)
+	sheet.Set(3, 1, white)
+	sm := &SheetManifest{Width: 2, Height: 2, Frames: []SheetFrame{
+		{X: 0, Y: 0, Width: 2, Height: 2, Duration: 40},
+		{X: 2, Y: 0, Width: 2, Height: 2, Duration: 60},
+	}}
+	g, err := FromSpriteSheet(sheet, sm)
+	if err != nil {
+		t.Fatal("FromSpriteSheet:", err)
+	}
+	c := Coalesce(g)
+	if len(c.Image) != 2 || c.Delay[0] != 4 || c.Delay[1] != 6 {
+		t.Fatal("unexpected frames:", len(c.Image), c.Delay)
+	}
+	if colorKey(c.Image[0].At(0, 0)) != colorKey(green) || colorKey(c.Image[1].At(1, 1)) != colorKey(white) {
+		t.Fatal("unexpected pixels:", c.Image[0].At(0, 0), c.Image[1].At(1, 1))
+	}
+	if _, _, _, a := c.Image[1].At(0, 0).RGBA(); a != 0 {
+		t.Fatal("expected transparent pixel:", c.Image[1].At(0, 0))
+	}
+}
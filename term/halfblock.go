@@ -0,0 +1,83 @@
+package term
+
+import (
+	"fmt"
+	"image"
+)
+
+// cell is a character cell holding two vertically stacked pixels, each 0xRRGGBB with bit 24
+// set, or zero if transparent.
+type cell struct {
+	top, bottom uint32
+}
+
+const opaqueBit = 1 << 24
+
+// halfBlock draws each pair of pixel rows as a row of character cells, skipping cells that are
+// unchanged since the previous frame when diffing.
+func (r *Renderer) halfBlock(m image.Image) {
+	b := m.Bounds()
+	cols, rows := b.Dx(), (b.Dy()+1)/2
+	cells := make([]cell, cols*rows)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, ok := opaque(m.At(x, y))
+			if !ok {
+				continue
+			}
+			i := (y-b.Min.Y)/2*cols + x - b.Min.X
+			if (y-b.Min.Y)%2 == 0 {
+				cells[i].top = c | opaqueBit
+			} else {
+				cells[i].bottom = c | opaqueBit
+			}
+		}
+	}
+
+	prev := r.cells
+	if !r.opts.Diff || len(prev) != len(cells) || rows != r.rows {
+		prev = nil
+	}
+	if prev == nil && r.rows > rows {
+		fmt.Fprint(r.w, "\x1b[0m\x1b[2J") // clear what the last frame drew
+	}
+
+	var fg, bg uint32 // current colors, where zero is the terminal's default
+	fmt.Fprint(r.w, "\x1b[0m")
+	for row := 0; row < rows; row++ {
+		moved := false // whether the cursor is at the next cell
+		for col := 0; col < cols; col++ {
+			c := cells[row*cols+col]
+			if prev != nil && prev[row*cols+col] == c {
+				moved = false
+				continue
+			}
+			if !moved {
+				fmt.Fprintf(r.w, "\x1b[%d;%dH", row+1, col+1)
+				moved = true
+			}
+
+			ch, f, k := '▀', c.top, c.bottom
+			if c.top == 0 {
+				ch, f, k = '▄', c.bottom, 0
+			}
+			if f == 0 {
+				ch = ' '
+			} else if f != fg {
+				fmt.Fprintf(r.w, "\x1b[38;2;%d;%d;%dm", f>>16&0xff, f>>8&0xff, f&0xff)
+				fg = f
+			}
+			if k != bg {
+				if k == 0 {
+					fmt.Fprint(r.w, "\x1b[49m")
+				} else {
+					fmt.Fprintf(r.w, "\x1b[48;2;%d;%d;%dm", k>>16&0xff, k>>8&0xff, k&0xff)
+				}
+				bg = k
+			}
+			r.w.WriteRune(ch)
+		}
+	}
+	fmt.Fprint(r.w, "\x1b[0m")
+	r.cells, r.rows = cells, rows
+}
@@ -0,0 +1,43 @@
+package term
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image"
+)
+
+// kittyChunk is the largest base64 payload allowed in one graphics escape sequence.
+const kittyChunk = 4096
+
+// kitty transmits the given RGBA pixels as a zlib compressed Kitty image and displays it at
+// the top left, replacing the previous frame's image.
+func (r *Renderer) kitty(pix []uint8, size image.Point) error {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(pix); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	fmt.Fprint(r.w, "\x1b[H")
+	for first := true; first || len(data) > 0; first = false {
+		chunk := data[:min(len(data), kittyChunk)]
+		data = data[len(chunk):]
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+		if first {
+			// transmit and display image 1 without moving the cursor or replying
+			fmt.Fprintf(r.w, "\x1b_Ga=T,f=32,o=z,s=%d,v=%d,i=1,p=1,C=1,q=2,m=%d;%s\x1b\\", size.X, size.Y, more, chunk)
+		} else {
+			fmt.Fprintf(r.w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package term
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+)
+
+// sixel draws the given frame as a Sixel image, using a color register for each palette entry
+// and one more for the background beneath transparent pixels.
+func (r *Renderer) sixel(pm *image.Paletted) {
+	b := pm.Rect
+	bg := uint32(0)
+	if r.opts.Background != nil {
+		bg, _ = opaque(r.opts.Background)
+	}
+
+	// map palette entries to color registers, merging duplicate colors
+	regs := make([]int, len(pm.Palette))
+	colors := make(map[uint32]int)
+	var defs []uint32
+	for i, c := range pm.Palette {
+		rgb, ok := opaque(c)
+		if !ok {
+			rgb = bg
+		}
+		reg, ok := colors[rgb]
+		if !ok {
+			reg = len(defs)
+			colors[rgb] = reg
+			defs = append(defs, rgb)
+		}
+		regs[i] = reg
+	}
+	bgReg, ok := colors[bg]
+	if !ok {
+		bgReg = len(defs)
+		defs = append(defs, bg)
+	}
+
+	fmt.Fprint(r.w, "\x1b[H\x1bP0;1;0q")
+	fmt.Fprintf(r.w, "\"1;1;%d;%d", b.Dx(), b.Dy())
+	for reg, rgb := range defs {
+		// color components are percentages
+		fmt.Fprintf(r.w, "#%d;2;%d;%d;%d", reg, (rgb>>16&0xff)*100/0xff, (rgb>>8&0xff)*100/0xff, (rgb&0xff)*100/0xff)
+	}
+
+	band := make([]uint8, b.Dx()) // sixel bits of one register across a band
+	for y0 := b.Min.Y; y0 < b.Max.Y; y0 += 6 {
+		used := make([]bool, len(defs))
+		for y := y0; y < min(y0+6, b.Max.Y); y++ {
+			for _, idx := range pm.Pix[pm.PixOffset(b.Min.X, y):pm.PixOffset(b.Max.X, y)] {
+				if int(idx) < len(regs) {
+					used[regs[idx]] = true
+				} else {
+					used[bgReg] = true
+				}
+			}
+		}
+
+		first := true
+		for reg, ok := range used {
+			if !ok {
+				continue
+			}
+			for i := range band {
+				band[i] = 0
+			}
+			for y := y0; y < min(y0+6, b.Max.Y); y++ {
+				row := pm.Pix[pm.PixOffset(b.Min.X, y):pm.PixOffset(b.Max.X, y)]
+				for x, idx := range row {
+					if (int(idx) < len(regs) && regs[idx] == reg) || (int(idx) >= len(regs) && reg == bgReg) {
+						band[x] |= 1 << (y - y0)
+					}
+				}
+			}
+			if !first {
+				r.w.WriteByte('$') // back to the start of the band
+			}
+			first = false
+			fmt.Fprintf(r.w, "#%d", reg)
+			writeRuns(r.w, band)
+		}
+		r.w.WriteByte('-') // next band
+	}
+	fmt.Fprint(r.w, "\x1b\\")
+}
+
+// writeRuns writes the given sixels, run-length encoding repeats.
+func writeRuns(w *bufio.Writer, band []uint8) {
+	for i := 0; i < len(band); {
+		j := i + 1
+		for j < len(band) && band[j] == band[i] {
+			j++
+		}
+		ch := '?' + band[i]
+		if n := j - i; n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, ch)
+		} else {
+			for ; n > 0; n-- {
+				w.WriteByte(ch)
+			}
+		}
+		i = j
+	}
+}
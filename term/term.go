@@ -0,0 +1,260 @@
+// Package term plays GIF animations in a terminal.
+//
+// Frames are drawn with half-block characters in 24-bit ANSI color, which most modern terminals
+// support, or as images using the Sixel or Kitty graphics protocols where the terminal offers
+// them. Frames are coalesced before drawing, so disposal methods are honored in every mode.
+package term
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// Mode selects how frames are drawn.
+type Mode int
+
+const (
+	HalfBlock Mode = iota // Two pixels per character cell using upper and lower half blocks.
+	Sixel                 // One pixel per pixel using the DEC Sixel graphics protocol.
+	Kitty                 // One pixel per pixel using the Kitty terminal graphics protocol.
+)
+
+// Options are the parameters for Play and NewRenderer.
+type Options struct {
+	Mode Mode
+	// Diff only redraws the character cells that changed since the previous frame in HalfBlock
+	// mode, and skips frames identical to the previous one in the other modes.
+	Diff bool
+	// Background is drawn beneath transparent pixels in Sixel mode, which can't leave pixels
+	// unchanged without showing earlier frames through them. Nil means black. The other modes
+	// leave transparent pixels showing the terminal's background.
+	Background color.Color
+}
+
+const (
+	// MinDelay is the shortest frame delay that browsers honor, the same as timeline.MinDelay.
+	MinDelay = 20 * time.Millisecond
+	// DefaultDelay replaces delays shorter than MinDelay, as in browsers.
+	DefaultDelay = 100 * time.Millisecond
+)
+
+// Play draws each frame of the given GIF to w at the top left of the terminal, waiting for each
+// frame's delay, and repeats according to the loop count. An animation that loops forever
+// plays until the context is done, in which case the context's error is returned.
+func Play(ctx context.Context, w io.Writer, g *gif.GIF, opts *Options) error {
+	p := &player{r: NewRenderer(w, opts), next: time.Now()}
+	for n := 0; p.more(g.LoopCount, n); n++ {
+		c := gif.NewCoalescer(g.Config)
+		for i, pm := range g.Image {
+			f := &gif.Frame{Image: pm}
+			if i < len(g.Disposal) {
+				f.DisposalMethod = g.Disposal[i]
+			}
+			if i < len(g.Delay) {
+				f.DelayTime = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+			}
+			if err := p.frame(ctx, c, f); err != nil {
+				return err
+			}
+		}
+	}
+	return p.r.Close()
+}
+
+// PlayStream is like Play, but reads the GIF from r one block at a time, so only the current
+// frame is held in memory. Each loop reads the GIF again, so an animation only repeats if r is
+// an io.Seeker that can seek back to the start, and otherwise plays once.
+func PlayStream(ctx context.Context, w io.Writer, r io.Reader, opts *Options) error {
+	p := &player{r: NewRenderer(w, opts), next: time.Now()}
+	loopCount := -1
+	for n := 0; p.more(loopCount, n); n++ {
+		if n > 0 {
+			s, ok := r.(io.Seeker)
+			if !ok {
+				break
+			} else if _, err := s.Seek(0, io.SeekStart); err != nil {
+				break
+			}
+		}
+
+		dec := gif.NewDecoder(r)
+		hdr, err := dec.ReadHeader()
+		if err != nil {
+			p.r.Close()
+			return err
+		}
+		c := gif.NewCoalescer(hdr.Config)
+		for {
+			blk, err := dec.ReadBlock()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				p.r.Close()
+				return err
+			}
+			switch blk := blk.(type) {
+			case *gif.ApplicationNetscape:
+				loopCount = blk.LoopCount
+			case *gif.Frame:
+				if err := p.frame(ctx, c, blk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return p.r.Close()
+}
+
+// player draws coalesced frames at the pace of their delays.
+type player struct {
+	r    *Renderer
+	next time.Time
+}
+
+// more reports whether an animation with the given loop count plays again after n plays.
+func (p *player) more(loopCount, n int) bool {
+	return loopCount == 0 || n < max(loopCount+1, 1)
+}
+
+// frame draws the given frame then waits for its delay, closing the renderer on failure.
+func (p *player) frame(ctx context.Context, c *gif.Coalescer, f *gif.Frame) error {
+	if err := p.r.Draw(c.Coalesce(f).Image); err != nil {
+		p.r.Close()
+		return err
+	}
+
+	delay := DefaultDelay
+	if f.DelayTime >= MinDelay {
+		delay = f.DelayTime
+	}
+	p.next = p.next.Add(delay)
+	timer := time.NewTimer(time.Until(p.next))
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		p.r.Close()
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return nil
+}
+
+// Renderer draws full frames to a terminal, each replacing the last at the top left.
+type Renderer struct {
+	w     *bufio.Writer
+	opts  Options
+	began bool
+	rows  int // character rows covered by the last frame in HalfBlock mode
+
+	// Previous frame, for Diff.
+	cells []cell
+	pix   []uint8
+	size  image.Point
+
+	q *gif.AnimationQuantizer // converts frames that aren't paletted in Sixel mode
+}
+
+// NewRenderer returns a new Renderer writing to w. Nothing is written until the first frame
+// is drawn, which clears the screen and hides the cursor until Close is called.
+func NewRenderer(w io.Writer, opts *Options) *Renderer {
+	r := &Renderer{w: bufio.NewWriter(w)}
+	if opts != nil {
+		r.opts = *opts
+	}
+	return r
+}
+
+// Draw draws the given full frame. Pixels less than half opaque are transparent.
+func (r *Renderer) Draw(m image.Image) error {
+	if !r.began {
+		r.began = true
+		fmt.Fprint(r.w, "\x1b[?25l\x1b[2J") // hide cursor, clear screen
+	}
+
+	switch r.opts.Mode {
+	case Sixel:
+		pm, ok := m.(*image.Paletted)
+		if !ok {
+			if r.q == nil {
+				r.q = gif.NewAnimationQuantizer(256)
+				r.q.Transparent = true
+			}
+			pm = r.q.Quantize(m)
+		}
+		if r.opts.Diff && !r.changed(nrgba(pm), pm.Rect.Size()) {
+			return nil
+		}
+		r.sixel(pm)
+	case Kitty:
+		pix := nrgba(m)
+		if r.opts.Diff && !r.changed(pix, m.Bounds().Size()) {
+			return nil
+		}
+		if err := r.kitty(pix, m.Bounds().Size()); err != nil {
+			return err
+		}
+	default:
+		r.halfBlock(m)
+	}
+	return r.w.Flush()
+}
+
+// changed records the pixels of a frame for Diff, reporting whether they differ from those of
+// the previous frame.
+func (r *Renderer) changed(pix []uint8, size image.Point) bool {
+	if size == r.size && string(pix) == string(r.pix) {
+		return false
+	}
+	r.pix, r.size = pix, size
+	return true
+}
+
+// Close resets the terminal's colors, moves the cursor below the last frame drawn in HalfBlock
+// mode and shows the cursor again.
+func (r *Renderer) Close() error {
+	if !r.began {
+		return nil
+	}
+	r.began = false
+	fmt.Fprint(r.w, "\x1b[0m")
+	if r.opts.Mode == HalfBlock {
+		fmt.Fprintf(r.w, "\x1b[%d;1H", r.rows+1)
+	}
+	fmt.Fprint(r.w, "\x1b[?25h")
+	return r.w.Flush()
+}
+
+// nrgba returns the pixels of the given image as non-premultiplied RGBA, with pixels less than
+// half opaque made fully transparent and the rest fully opaque, as in a GIF.
+func nrgba(m image.Image) []uint8 {
+	b := m.Bounds()
+	pix := make([]uint8, 0, 4*b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, ok := opaque(m.At(x, y))
+			if !ok {
+				pix = append(pix, 0, 0, 0, 0)
+				continue
+			}
+			pix = append(pix, uint8(c>>16), uint8(c>>8), uint8(c), 0xff)
+		}
+	}
+	return pix
+}
+
+// opaque returns the given color as 0xRRGGBB, or false if it is less than half opaque.
+func opaque(c color.Color) (uint32, bool) {
+	r, g, b, a := c.RGBA()
+	if a < 0x8000 {
+		return 0, false
+	}
+	r, g, b = r*0xffff/a>>8, g*0xffff/a>>8, b*0xffff/a>>8
+	return r<<16 | g<<8 | b, true
+}
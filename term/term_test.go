@@ -0,0 +1,221 @@
+package term
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+var (
+	red   = color.RGBA{R: 0xff, A: 0xff}
+	green = color.RGBA{G: 0xff, A: 0xff}
+	blue  = color.RGBA{B: 0xff, A: 0xff}
+	white = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+func TestHalfBlock(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 2, 3))
+	m.Set(0, 0, red)
+	m.Set(0, 1, blue)
+	m.Set(0, 2, green)
+	m.Set(1, 2, white)
+
+	buf := &bytes.Buffer{}
+	r := NewRenderer(buf, &Options{Diff: true})
+	if err := r.Draw(m); err != nil {
+		t.Fatal("Draw:", err)
+	}
+	want := "\x1b[?25l\x1b[2J\x1b[0m" +
+		"\x1b[1;1H\x1b[38;2;255;0;0m\x1b[48;2;0;0;255m▀\x1b[49m " +
+		"\x1b[2;1H\x1b[38;2;0;255;0m▀\x1b[38;2;255;255;255m▀" +
+		"\x1b[0m"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// unchanged cells are skipped
+	buf.Reset()
+	if err := r.Draw(m); err != nil {
+		t.Fatal("Draw:", err)
+	}
+	if got := buf.String(); got != "\x1b[0m\x1b[0m" {
+		t.Fatalf("unchanged frame drew %q", got)
+	}
+	buf.Reset()
+	m.Set(1, 2, color.Transparent)
+	if err := r.Draw(m); err != nil {
+		t.Fatal("Draw:", err)
+	}
+	if got := buf.String(); got != "\x1b[0m\x1b[2;2H \x1b[0m" {
+		t.Fatalf("changed cell drew %q", got)
+	}
+
+	buf.Reset()
+	if err := r.Close(); err != nil {
+		t.Fatal("Close:", err)
+	}
+	if got := buf.String(); got != "\x1b[0m\x1b[3;1H\x1b[?25h" {
+		t.Fatalf("Close wrote %q", got)
+	}
+}
+
+func TestSixel(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 5, 7), color.Palette{red, color.Transparent, red})
+	for i := range pm.Pix {
+		pm.Pix[i] = 1
+	}
+	for x := 0; x < 5; x++ {
+		pm.Pix[pm.PixOffset(x, 0)] = 0
+	}
+	pm.Pix[pm.PixOffset(1, 6)] = 2
+
+	buf := &bytes.Buffer{}
+	if err := NewRenderer(buf, &Options{Mode: Sixel, Background: white}).Draw(pm); err != nil {
+		t.Fatal("Draw:", err)
+	}
+	// the first band has a row of red above five rows of white, the second a single red pixel
+	want := "\x1b[H\x1bP0;1;0q\"1;1;5;7#0;2;100;0;0#1;2;100;100;100" +
+		"#0!5@$#1!5}-" +
+		"#0?@???$#1@?@@@-" +
+		"\x1b\\"
+	if got := strings.TrimPrefix(buf.String(), "\x1b[?25l\x1b[2J"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestKitty(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	x := uint32(1)
+	for i := range m.Pix {
+		x = x*1103515245 + 12345
+		m.Pix[i] = uint8(x >> 16)
+	}
+	for i := 3; i < len(m.Pix); i += 4 {
+		m.Pix[i] = 0xff
+	}
+
+	buf := &bytes.Buffer{}
+	if err := NewRenderer(buf, &Options{Mode: Kitty}).Draw(m); err != nil {
+		t.Fatal("Draw:", err)
+	}
+	seqs := regexp.MustCompile("\x1b_G([^;]*);([^\x1b]*)\x1b\\\\").FindAllStringSubmatch(buf.String(), -1)
+	if len(seqs) < 2 {
+		t.Fatal("expected multiple chunks, got", len(seqs))
+	}
+	if want := "a=T,f=32,o=z,s=64,v=64,i=1,p=1,C=1,q=2,m=1"; seqs[0][1] != want {
+		t.Fatalf("got control %q, want %q", seqs[0][1], want)
+	}
+	var data string
+	for i, seq := range seqs {
+		want := "m=1"
+		if i == len(seqs)-1 {
+			want = "m=0"
+		}
+		if i > 0 && seq[1] != want {
+			t.Fatalf("chunk %d control %q, want %q", i, seq[1], want)
+		}
+		data += seq[2]
+	}
+	z, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatal("DecodeString:", err)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(z))
+	if err != nil {
+		t.Fatal("zlib.NewReader:", err)
+	}
+	pix, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal("ReadAll:", err)
+	}
+	if !bytes.Equal(pix, m.Pix) {
+		t.Fatal("pixels differ")
+	}
+}
+
+func TestPlay(t *testing.T) {
+	p := color.Palette{red, blue, color.Transparent}
+	f0 := image.NewPaletted(image.Rect(0, 0, 2, 2), p)
+	f1 := image.NewPaletted(image.Rect(1, 1, 2, 2), p)
+	f1.Pix[0] = 1
+	g := &gif.GIF{
+		Image:     []*image.Paletted{f0, f1},
+		Delay:     []int{2, 2},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground},
+		LoopCount: 1,
+		Config:    image.Config{Width: 2, Height: 2, ColorModel: p},
+	}
+
+	buf := &bytes.Buffer{}
+	start := time.Now()
+	if err := Play(context.Background(), buf, g, nil); err != nil {
+		t.Fatal("Play:", err)
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Fatal("played too quickly:", d)
+	}
+	if n := strings.Count(buf.String(), "\x1b[1;1H"); n != 4 {
+		t.Fatal("unexpected frame count:", n)
+	}
+	// only the second frame of each loop has a blue pixel
+	if n := strings.Count(buf.String(), "\x1b[48;2;0;0;255m▀"); n != 2 {
+		t.Fatal("unexpected frame content:", n)
+	}
+
+	g.LoopCount = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Play(ctx, io.Discard, g, nil); err != context.DeadlineExceeded {
+		t.Fatal("expected deadline exceeded, got", err)
+	}
+}
+
+func TestPlayStream(t *testing.T) {
+	p := color.Palette{red, blue, color.Transparent}
+	f0 := image.NewPaletted(image.Rect(0, 0, 2, 2), p)
+	f1 := image.NewPaletted(image.Rect(1, 1, 2, 2), p)
+	f1.Pix[0] = 1
+	data := &bytes.Buffer{}
+	if err := gif.EncodeAll(data, &gif.GIF{
+		Image:     []*image.Paletted{f0, f1},
+		Delay:     []int{2, 2},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground},
+		LoopCount: 1,
+		Config:    image.Config{Width: 2, Height: 2, ColorModel: p},
+	}); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+
+	testCases := []struct {
+		name   string
+		r      io.Reader
+		frames int
+	}{
+		{"seeker", bytes.NewReader(data.Bytes()), 4},
+		{"reader", struct{ io.Reader }{bytes.NewReader(data.Bytes())}, 2}, // can't loop
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := PlayStream(context.Background(), buf, tc.r, nil); err != nil {
+				t.Fatal("PlayStream:", err)
+			}
+			if n := strings.Count(buf.String(), "\x1b[1;1H"); n != tc.frames {
+				t.Fatal("unexpected frame count:", n)
+			}
+			if n := strings.Count(buf.String(), "\x1b[48;2;0;0;255m▀"); n != tc.frames/2 {
+				t.Fatal("unexpected frame content:", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Package timeline edits the frame order and timing of GIF animations.
+//
+// Operations that change which frames are shown, or in what order, first coalesce the
+// animation into full logical screen frames and then re-optimize the result, so the output is
+// correct regardless of the disposal methods used and stays small. No function modifies its
+// input, although the returned GIF may share palettes and images with it.
+package timeline
+
+import (
+	"errors"
+	"image"
+	"math"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+// MinDelay is the shortest frame delay, in 100ths of a second, that browsers honor.
+// Shorter delays are typically displayed as 10.
+const MinDelay = 2
+
+// Duration returns the total display time of one loop of the given GIF.
+func Duration(g *gif.GIF) time.Duration {
+	d := 0
+	for i := range g.Image {
+		d += delay(g, i)
+	}
+	return centis(d)
+}
+
+// Reverse returns a copy of the given GIF with its frames in reverse order.
+// Each frame keeps its own delay.
+func Reverse(g *gif.GIF) *gif.GIF {
+	c := gif.Coalesce(g)
+	n := len(c.Image)
+	frames := make([]*image.Paletted, n)
+	delays := make([]int, n)
+	for i := range frames {
+		frames[i] = c.Image[n-1-i]
+		delays[i] = delay(c, n-1-i)
+	}
+	return rebuild(g, frames, delays)
+}
+
+// Boomerang returns a copy of the given GIF that plays forwards then backwards.
+// The first and last frames are not repeated, so looping is seamless.
+func Boomerang(g *gif.GIF) *gif.GIF {
+	c := gif.Coalesce(g)
+	n := len(c.Image)
+	frames := append([]*image.Paletted(nil), c.Image...)
+	delays := make([]int, n, 2*n)
+	for i := range delays {
+		delays[i] = delay(c, i)
+	}
+	for i := n - 2; i > 0; i-- {
+		frames = append(frames, c.Image[i])
+		delays = append(delays, delay(c, i))
+	}
+	return rebuild(g, frames, delays)
+}
+
+// ScaleDelays returns a copy of the given GIF with every delay multiplied by the given factor,
+// so a factor of 2 plays at half speed. Scaled delays are rounded and clamped to MinDelay.
+func ScaleDelays(g *gif.GIF, factor float64) (*gif.GIF, error) {
+	if !(factor > 0) || math.IsInf(factor, 0) {
+		return nil, errors.New("timeline: invalid delay factor")
+	}
+
+	out := *g
+	out.Delay = make([]int, len(g.Image))
+	for i := range out.Delay {
+		out.Delay[i] = max(int(math.Round(float64(delay(g, i))*factor)), MinDelay)
+	}
+	return &out, nil
+}
+
+// FrameRate returns a copy of the given GIF resampled to the given number of frames per
+// second, with every frame having the same delay. Frames are duplicated or dropped as needed to
+// preserve the overall duration, where delays shorter than MinDelay, including zero, count as
+// MinDelay so that every frame is shown. Since delays are whole 100ths of a second, and clamped
+// to MinDelay, the actual rate may differ slightly from the one requested.
+func FrameRate(g *gif.GIF, fps float64) (*gif.GIF, error) {
+	if !(fps > 0) || math.IsInf(fps, 0) {
+		return nil, errors.New("timeline: invalid frame rate")
+	}
+
+	c := gif.Coalesce(g)
+	if len(c.Image) == 0 {
+		return c, nil
+	}
+	step := max(int(math.Round(100/fps)), MinDelay)
+	shown := func(i int) int {
+		return max(delay(c, i), MinDelay)
+	}
+	total := 0
+	for i := range c.Image {
+		total += shown(i)
+	}
+	n := max(int(math.Round(float64(total)/float64(step))), 1)
+
+	frames := make([]*image.Paletted, n)
+	delays := make([]int, n)
+	i, end := 0, shown(0)
+	for k := range frames {
+		// sample the frame being displayed at the midpoint of each step
+		t := k*step + step/2
+		for i < len(c.Image)-1 && end <= t {
+			i++
+			end += shown(i)
+		}
+		frames[k] = c.Image[i]
+		delays[k] = step
+	}
+	return rebuild(g, frames, delays), nil
+}
+
+// DropEvery returns a copy of the given GIF with every nth frame removed, starting with frame
+// n-1. The delay of each removed frame is added to the frame before it, so the overall duration
+// is unchanged.
+func DropEvery(g *gif.GIF, n int) (*gif.GIF, error) {
+	if n < 2 {
+		return nil, errors.New("timeline: invalid drop interval")
+	}
+
+	c := gif.Coalesce(g)
+	var frames []*image.Paletted
+	var delays []int
+	for i, pm := range c.Image {
+		if (i+1)%n == 0 {
+			delays[len(delays)-1] += delay(c, i)
+			continue
+		}
+		frames = append(frames, pm)
+		delays = append(delays, delay(c, i))
+	}
+	return rebuild(g, frames, delays), nil
+}
+
+// TrimFrames returns a copy of the given GIF containing only frames start up to but not
+// including end.
+func TrimFrames(g *gif.GIF, start, end int) (*gif.GIF, error) {
+	if start < 0 || end > len(g.Image) || start >= end {
+		return nil, errors.New("timeline: invalid frame range")
+	}
+
+	c := gif.Coalesce(g)
+	delays := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		delays = append(delays, delay(c, i))
+	}
+	return rebuild(g, c.Image[start:end], delays), nil
+}
+
+// TrimTime returns a copy of the given GIF containing only what is displayed from the start
+// time up to the end time, measured from the beginning of the first loop. The first and last
+// frames are shortened where they straddle the range. Times are rounded to 100ths of a second.
+func TrimTime(g *gif.GIF, start, end time.Duration) (*gif.GIF, error) {
+	s, e := toCentis(start), toCentis(end)
+	if s < 0 || s >= e {
+		return nil, errors.New("timeline: invalid time range")
+	}
+
+	c := gif.Coalesce(g)
+	var frames []*image.Paletted
+	var delays []int
+	t := 0
+	for i, pm := range c.Image {
+		d := delay(c, i)
+		if t+d > s && t < e {
+			frames = append(frames, pm)
+			delays = append(delays, min(t+d, e)-max(t, s))
+		}
+		t += d
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("timeline: time range outside animation")
+	}
+	return rebuild(g, frames, delays), nil
+}
+
+// rebuild returns a GIF displaying the given full logical screen frames in order, based on
+// the logical screen and loop count of g. Every frame is initially disposed to the background
+// so it is shown exactly as given, then coalescing keeps only the disposals that are needed
+// before the frames are optimized.
+func rebuild(g *gif.GIF, frames []*image.Paletted, delays []int) *gif.GIF {
+	full := &gif.GIF{
+		Image:           frames,
+		Delay:           delays,
+		Disposal:        make([]byte, len(frames)),
+		LoopCount:       g.LoopCount,
+		Config:          g.Config,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+	for i := range full.Disposal {
+		full.Disposal[i] = gif.DisposalBackground
+	}
+	out := gif.Coalesce(full)
+	gif.OptimizeCoalesced(out)
+	return out
+}
+
+func delay(g *gif.GIF, i int) int {
+	if i < len(g.Delay) {
+		return g.Delay[i]
+	}
+	return 0
+}
+
+func centis(n int) time.Duration {
+	return time.Duration(n) * 10 * time.Millisecond
+}
+
+func toCentis(d time.Duration) int {
+	return int(d.Round(10*time.Millisecond) / (10 * time.Millisecond))
+}
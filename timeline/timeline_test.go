@@ -0,0 +1,151 @@
+package timeline
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/NathanBaulch/gifx"
+)
+
+var colors = []color.Color{
+	color.RGBA{R: 0xff, A: 0xff},
+	color.RGBA{G: 0xff, A: 0xff},
+	color.RGBA{B: 0xff, A: 0xff},
+	color.RGBA{R: 0xff, G: 0xff, A: 0xff},
+	color.Transparent,
+}
+
+// testGIF returns a 2x1 animation that displays [0 0], [0 1], [2 1] and [- 3], where - is transparent.
+func testGIF() *gif.GIF {
+	p := color.Palette(colors)
+	newFrame := func(r image.Rectangle, pix ...uint8) *image.Paletted {
+		pm := image.NewPaletted(r, p)
+		copy(pm.Pix, pix)
+		return pm
+	}
+	return &gif.GIF{
+		Image: []*image.Paletted{
+			newFrame(image.Rect(0, 0, 2, 1), 0, 0),
+			newFrame(image.Rect(1, 0, 2, 1), 1),
+			newFrame(image.Rect(0, 0, 1, 1), 2),
+			newFrame(image.Rect(1, 0, 2, 1), 3),
+		},
+		Delay:    []int{10, 20, 30, 40},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 2, Height: 1, ColorModel: p},
+	}
+}
+
+var displayed = [][2]int{{0, 0}, {0, 1}, {2, 1}, {4, 3}}
+
+func TestTimeline(t *testing.T) {
+	testCases := []struct {
+		name   string
+		fn     func(*gif.GIF) (*gif.GIF, error)
+		frames []int
+		delays []int
+	}{
+		{"Reverse", func(g *gif.GIF) (*gif.GIF, error) { return Reverse(g), nil }, []int{3, 2, 1, 0}, []int{40, 30, 20, 10}},
+		{"Boomerang", func(g *gif.GIF) (*gif.GIF, error) { return Boomerang(g), nil }, []int{0, 1, 2, 3, 2, 1}, []int{10, 20, 30, 40, 30, 20}},
+		{"ScaleDelays", func(g *gif.GIF) (*gif.GIF, error) { return ScaleDelays(g, 0.1) }, []int{0, 1, 2, 3}, []int{2, 2, 3, 4}},
+		{"FrameRate", func(g *gif.GIF) (*gif.GIF, error) { return FrameRate(g, 5) }, []int{1, 2, 2, 3, 3}, []int{20, 20, 20, 20, 20}},
+		{"DropEvery", func(g *gif.GIF) (*gif.GIF, error) { return DropEvery(g, 2) }, []int{0, 2}, []int{30, 70}},
+		{"TrimFrames", func(g *gif.GIF) (*gif.GIF, error) { return TrimFrames(g, 1, 3) }, []int{1, 2}, []int{20, 30}},
+		{"TrimTime", func(g *gif.GIF) (*gif.GIF, error) { return TrimTime(g, 150*time.Millisecond, 450*time.Millisecond) }, []int{1, 2}, []int{15, 15}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := testGIF()
+			out, err := tc.fn(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// round trip through the encoder
+			buf := &bytes.Buffer{}
+			if err := gif.EncodeAll(buf, out); err != nil {
+				t.Fatal("EncodeAll:", err)
+			}
+			if out, err = gif.DecodeAll(buf); err != nil {
+				t.Fatal("DecodeAll:", err)
+			}
+
+			if len(out.Image) != len(tc.frames) {
+				t.Fatal("unexpected frame count:", len(out.Image), "want:", len(tc.frames))
+			}
+			c := gif.Coalesce(out)
+			for i, pm := range c.Image {
+				for x, want := range displayed[tc.frames[i]] {
+					if got := pm.At(x, 0); !sameColor(got, colors[want]) {
+						t.Fatal("frame", i, "unexpected pixel", x, "got:", got, "want:", colors[want])
+					}
+				}
+				if out.Delay[i] != tc.delays[i] {
+					t.Fatal("frame", i, "unexpected delay:", out.Delay[i], "want:", tc.delays[i])
+				}
+			}
+
+			if g.Image[1].Rect != image.Rect(1, 0, 2, 1) || g.Delay[0] != 10 {
+				t.Fatal("input modified")
+			}
+		})
+	}
+}
+
+func TestTimelineErrors(t *testing.T) {
+	g := testGIF()
+	if _, err := ScaleDelays(g, 0); err == nil {
+		t.Fatal("expected invalid factor error")
+	}
+	if _, err := FrameRate(g, -1); err == nil {
+		t.Fatal("expected invalid frame rate error")
+	}
+	if _, err := DropEvery(g, 1); err == nil {
+		t.Fatal("expected invalid interval error")
+	}
+	if _, err := TrimFrames(g, 2, 5); err == nil {
+		t.Fatal("expected invalid frame range error")
+	}
+	if _, err := TrimTime(g, 2*time.Second, 3*time.Second); err == nil {
+		t.Fatal("expected empty time range error")
+	}
+}
+
+func TestFrameRateZeroDelays(t *testing.T) {
+	g := testGIF()
+	g.Delay = []int{0, 0, 0, 0}
+	out, err := FrameRate(g, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != len(g.Image) {
+		t.Fatal("unexpected frame count:", len(out.Image), "want:", len(g.Image))
+	}
+	c := gif.Coalesce(out)
+	for i, pm := range c.Image {
+		for x, want := range displayed[i] {
+			if got := pm.At(x, 0); !sameColor(got, colors[want]) {
+				t.Fatal("frame", i, "unexpected pixel", x, "got:", got, "want:", colors[want])
+			}
+		}
+		if out.Delay[i] != MinDelay {
+			t.Fatal("frame", i, "unexpected delay:", out.Delay[i])
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	if d := Duration(testGIF()); d != time.Second {
+		t.Fatal("unexpected duration:", d)
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return a1 == 0 && a2 == 0 || r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
@@ -0,0 +1,273 @@
+package gif
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Transform is a geometric transformation applied to an entire animation.
+type Transform struct {
+	op   transformOp
+	crop image.Rectangle
+}
+
+type transformOp int
+
+const (
+	opCrop transformOp = iota
+	opFlipH
+	opFlipV
+	opRotate90
+	opRotate180
+	opRotate270
+)
+
+// Crop returns a transform that crops the logical screen to the given rectangle.
+func Crop(r image.Rectangle) Transform {
+	return Transform{op: opCrop, crop: r.Canon()}
+}
+
+var (
+	FlipHorizontal = Transform{op: opFlipH}     // Mirrors left to right.
+	FlipVertical   = Transform{op: opFlipV}     // Mirrors top to bottom.
+	Rotate90       = Transform{op: opRotate90}  // Rotates 90 degrees clockwise.
+	Rotate180      = Transform{op: opRotate180} // Rotates 180 degrees.
+	Rotate270      = Transform{op: opRotate270} // Rotates 90 degrees counter-clockwise.
+)
+
+// TransformGIF returns a copy of the given GIF with the given transforms applied in order.
+func TransformGIF(g *GIF, ts ...Transform) (*GIF, error) {
+	out := &GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           append([]int(nil), g.Delay...),
+		LoopCount:       g.LoopCount,
+		Config:          g.Config,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+	if g.Disposal != nil {
+		out.Disposal = make([]byte, len(g.Image))
+	}
+
+	tr, err := newTransformer(g.Config, ts)
+	if err != nil {
+		return nil, err
+	}
+	out.Config = tr.config()
+	for i, pm := range g.Image {
+		f := &Frame{Image: pm}
+		if g.Disposal != nil {
+			f.DisposalMethod = g.Disposal[i]
+		}
+		f = tr.frame(f)
+		out.Image[i] = f.Image
+		if out.Disposal != nil {
+			out.Disposal[i] = f.DisposalMethod
+		}
+	}
+	return out, nil
+}
+
+// TransformStream reads every block from the given decoder, applies the given transforms in
+// order and writes the result to the given encoder. Frame bounds, the logical screen size and
+// plain text grid positions are all adjusted.
+func TransformStream(enc *Encoder, dec *Decoder, ts ...Transform) error {
+	hdr, err := dec.ReadHeader()
+	if err != nil {
+		return err
+	}
+	tr, err := newTransformer(hdr.Config, ts)
+	if err != nil {
+		return err
+	}
+	hdr.Config = tr.config()
+	if hdr.AspectRatio != 0 && tr.rotated() {
+		hdr.SetPixelAspectRatio(1 / hdr.PixelAspectRatio())
+	}
+	if err := enc.WriteHeaderFrom(hdr); err != nil {
+		return err
+	}
+
+	for {
+		blk, err := dec.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch blk := blk.(type) {
+		case *Frame:
+			err = enc.WriteFrame(tr.frame(blk))
+		case *PlainText:
+			err = enc.WritePlainText(tr.plainText(blk))
+		case *Comment:
+			err = enc.WriteComment(blk)
+		case *ApplicationNetscape:
+			err = enc.WriteApplicationNetscape(blk)
+		case *UnknownApplication:
+			err = enc.WriteUnknownApplication(blk)
+		case *UnknownExtension:
+			err = enc.WriteUnknownExtension(blk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := enc.WriteTrailer(); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// transformer applies a sequence of transforms, tracking the logical screen size at each stage.
+type transformer struct {
+	cfg     image.Config
+	ts      []Transform
+	screens []image.Rectangle // screen before each transform, followed by the final screen
+}
+
+func newTransformer(cfg image.Config, ts []Transform) (*transformer, error) {
+	tr := &transformer{cfg: cfg, ts: ts, screens: []image.Rectangle{image.Rect(0, 0, cfg.Width, cfg.Height)}}
+	for _, t := range ts {
+		s := tr.screens[len(tr.screens)-1]
+		switch t.op {
+		case opCrop:
+			if c := t.crop.Intersect(s); c.Empty() {
+				return nil, errors.New("gif: crop rectangle outside logical screen")
+			} else {
+				s = c.Sub(c.Min)
+			}
+		case opRotate90, opRotate270:
+			s = image.Rect(0, 0, s.Dy(), s.Dx())
+		}
+		tr.screens = append(tr.screens, s)
+	}
+	return tr, nil
+}
+
+func (tr *transformer) config() image.Config {
+	s := tr.screens[len(tr.screens)-1]
+	return image.Config{ColorModel: tr.cfg.ColorModel, Width: s.Dx(), Height: s.Dy()}
+}
+
+// rotated reports whether the transforms swap the axes.
+func (tr *transformer) rotated() bool {
+	n := 0
+	for _, t := range tr.ts {
+		if t.op == opRotate90 || t.op == opRotate270 {
+			n++
+		}
+	}
+	return n%2 == 1
+}
+
+// rect maps a rectangle on the screen s through the transform t.
+func (t Transform) rect(r, s image.Rectangle) image.Rectangle {
+	w, h := s.Dx(), s.Dy()
+	switch t.op {
+	case opCrop:
+		return r.Intersect(t.crop).Sub(t.crop.Intersect(s).Min)
+	case opFlipH:
+		return image.Rect(w-r.Max.X, r.Min.Y, w-r.Min.X, r.Max.Y)
+	case opFlipV:
+		return image.Rect(r.Min.X, h-r.Max.Y, r.Max.X, h-r.Min.Y)
+	case opRotate90:
+		return image.Rect(h-r.Max.Y, r.Min.X, h-r.Min.Y, r.Max.X)
+	case opRotate180:
+		return image.Rect(w-r.Max.X, h-r.Max.Y, w-r.Min.X, h-r.Min.Y)
+	default:
+		return image.Rect(r.Min.Y, w-r.Max.X, r.Max.Y, w-r.Min.X)
+	}
+}
+
+// point maps a pixel on the screen s through the transform t.
+func (t Transform) point(x, y int, s image.Rectangle) (int, int) {
+	w, h := s.Dx(), s.Dy()
+	switch t.op {
+	case opCrop:
+		o := t.crop.Intersect(s).Min
+		return x - o.X, y - o.Y
+	case opFlipH:
+		return w - 1 - x, y
+	case opFlipV:
+		return x, h - 1 - y
+	case opRotate90:
+		return h - 1 - y, x
+	case opRotate180:
+		return w - 1 - x, h - 1 - y
+	default:
+		return y, w - 1 - x
+	}
+}
+
+func (tr *transformer) frame(f *Frame) *Frame {
+	out := *f
+	for i, t := range tr.ts {
+		out.Image = t.paletted(out.Image, tr.screens[i])
+		if out.Image.Rect.Empty() {
+			// The frame lies entirely outside the cropped screen but is kept for its delay.
+			out.Image = emptyFrame(f.Image.Palette)
+			out.DisposalMethod = DisposalNone
+		}
+	}
+	return &out
+}
+
+func (t Transform) paletted(pm *image.Paletted, s image.Rectangle) *image.Paletted {
+	r := t.rect(pm.Rect, s)
+	dst := image.NewPaletted(r, pm.Palette)
+	if r.Empty() {
+		return dst
+	}
+	src := pm.Rect
+	if t.op == opCrop {
+		src = src.Intersect(t.crop)
+	}
+	for y := src.Min.Y; y < src.Max.Y; y++ {
+		i := pm.PixOffset(src.Min.X, y)
+		for x := src.Min.X; x < src.Max.X; x++ {
+			dx, dy := t.point(x, y, s)
+			dst.Pix[dst.PixOffset(dx, dy)] = pm.Pix[i]
+			i++
+		}
+	}
+	return dst
+}
+
+// emptyFrame returns a single transparent pixel, extending the palette if necessary.
+func emptyFrame(p color.Palette) *image.Paletted {
+	pm := image.NewPaletted(image.Rect(0, 0, 1, 1), p)
+	if i := findTransparent(p); i >= 0 {
+		pm.Pix[0] = uint8(i)
+	} else if len(p) < 256 {
+		pm.Palette = append(p[:len(p):len(p)], color.Transparent)
+		pm.Pix[0] = uint8(len(p))
+	} else {
+		// a full palette can't be extended, and the pixel needs no other color
+		pm.Palette = color.Palette{color.Transparent}
+	}
+	return pm
+}
+
+func (tr *transformer) plainText(pt *PlainText) *PlainText {
+	out := *pt
+	for i, t := range tr.ts {
+		r := image.Rect(int(out.TextGridLeftPosition), int(out.TextGridTopPosition),
+			int(out.TextGridLeftPosition)+int(out.TextGridWidth), int(out.TextGridTopPosition)+int(out.TextGridHeight))
+		r = t.rect(r, tr.screens[i])
+		if r.Empty() {
+			r = image.Rectangle{}
+		}
+		out.TextGridLeftPosition = uint16(r.Min.X)
+		out.TextGridTopPosition = uint16(r.Min.Y)
+		out.TextGridWidth = uint16(r.Dx())
+		out.TextGridHeight = uint16(r.Dy())
+		if t.op == opRotate90 || t.op == opRotate270 {
+			out.CharacterCellWidth, out.CharacterCellHeight = out.CharacterCellHeight, out.CharacterCellWidth
+		}
+	}
+	return &out
+}
@@ -0,0 +1,130 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestTransformGIF(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	gp := color.Palette{black, white, red, color.Transparent}
+	pm0 := image.NewPaletted(image.Rect(0, 0, 3, 2), gp)
+	copy(pm0.Pix, []uint8{0, 1, 2, 1, 2, 0})
+	pm1 := image.NewPaletted(image.Rect(1, 1, 3, 2), gp)
+	copy(pm1.Pix, []uint8{3, 1})
+	g := &GIF{
+		Image:    []*image.Paletted{pm0, pm1},
+		Delay:    []int{1, 2},
+		Disposal: []byte{DisposalNone, DisposalBackground},
+		Config:   image.Config{Width: 3, Height: 2, ColorModel: gp},
+	}
+	want := Coalesce(g)
+
+	for _, tr := range []Transform{FlipHorizontal, FlipVertical, Rotate90, Rotate180, Rotate270, Crop(image.Rect(1, 1, 5, 5))} {
+		got, err := TransformGIF(g, tr)
+		if err != nil {
+			t.Fatal("TransformGIF:", err)
+		}
+		s := image.Rect(0, 0, 3, 2)
+		if r := tr.rect(s, s); got.Config.Width != r.Dx() || got.Config.Height != r.Dy() {
+			t.Fatal("unexpected size:", got.Config.Width, got.Config.Height)
+		}
+		if !reflect.DeepEqual(got.Delay, g.Delay) || !reflect.DeepEqual(got.Disposal, g.Disposal) {
+			t.Fatal("unexpected timing:", got.Delay, got.Disposal)
+		}
+		c := Coalesce(got)
+		for i, pm := range want.Image {
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 3; x++ {
+					tx, ty := tr.point(x, y, s)
+					if !image.Pt(tx, ty).In(c.Image[i].Rect) {
+						continue
+					}
+					if g, w := c.Image[i].At(tx, ty), pm.At(x, y); colorKey(g) != colorKey(w) {
+						t.Fatal("transform", tr.op, "frame", i, "unexpected pixel", x, y, "got:", g, "want:", w)
+					}
+				}
+			}
+		}
+	}
+
+	if _, err := TransformGIF(g, Crop(image.Rect(5, 5, 6, 6))); err == nil {
+		t.Fatal("expected crop error")
+	}
+	if got, err := TransformGIF(g, Crop(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal("TransformGIF:", err)
+	} else if got.Image[1].Rect != image.Rect(0, 0, 1, 1) || got.Disposal[1] != DisposalNone {
+		t.Fatal("unexpected placeholder frame:", got.Image[1].Rect, got.Disposal[1])
+	}
+
+	// a full palette without a transparent entry still leaves the screen unchanged
+	full := make(color.Palette, 256)
+	for i := range full {
+		full[i] = color.RGBA{uint8(i), uint8(i), uint8(i), 0xff}
+	}
+	pm2 := image.NewPaletted(image.Rect(2, 1, 3, 2), full)
+	pm2.Pix[0] = 0xff
+	g2 := &GIF{Image: []*image.Paletted{pm0, pm2}, Delay: []int{1, 2}, Config: g.Config}
+	if got, err := TransformGIF(g2, Crop(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal("TransformGIF:", err)
+	} else if c := got.Image[1].At(0, 0); len(got.Image) != 2 || colorKey(c) != colorKey(color.Transparent) {
+		t.Fatal("unexpected placeholder pixel:", c)
+	}
+}
+
+func TestTransformStream(t *testing.T) {
+	pt := &PlainText{
+		TextGridLeftPosition: 1,
+		TextGridTopPosition:  2,
+		TextGridWidth:        3,
+		TextGridHeight:       4,
+		CharacterCellWidth:   1,
+		CharacterCellHeight:  2,
+		Strings:              []string{"hi"},
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeaderFrom(&Header{Version: "GIF89a", Config: image.Config{Width: 10, Height: 8}, AspectRatio: 113}); err != nil {
+		t.Fatal("WriteHeaderFrom:", err)
+	}
+	if err := enc.WritePlainText(pt); err != nil {
+		t.Fatal("WritePlainText:", err)
+	}
+	pm := image.NewPaletted(image.Rect(1, 1, 3, 2), color.Palette{black, white})
+	pm.Pix[1] = 1
+	if err := enc.WriteFrame(&Frame{Image: pm}); err != nil {
+		t.Fatal("WriteFrame:", err)
+	}
+	if err := enc.WriteTrailer(); err != nil {
+		t.Fatal("WriteTrailer:", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal("Flush:", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := TransformStream(NewEncoder(out), NewDecoder(buf), Rotate90); err != nil {
+		t.Fatal("TransformStream:", err)
+	}
+
+	dec := NewDecoder(out)
+	if hdr, err := dec.ReadHeader(); err != nil {
+		t.Fatal("ReadHeader:", err)
+	} else if hdr.Config.Width != 8 || hdr.Config.Height != 10 || hdr.PixelAspectRatio() != 0.5 {
+		t.Fatal("unexpected header:", hdr)
+	}
+	if blk, err := dec.ReadBlock(); err != nil {
+		t.Fatal("ReadBlock:", err)
+	} else if got := blk.(*PlainText); got.TextGridLeftPosition != 2 || got.TextGridTopPosition != 1 ||
+		got.TextGridWidth != 4 || got.TextGridHeight != 3 || got.CharacterCellWidth != 2 || got.CharacterCellHeight != 1 {
+		t.Fatal("unexpected plain text:", got)
+	}
+	if blk, err := dec.ReadBlock(); err != nil {
+		t.Fatal("ReadBlock:", err)
+	} else if got := blk.(*Frame).Image; got.Rect != image.Rect(6, 1, 7, 3) || got.Pix[0] != 0 || got.Pix[1] != 1 {
+		t.Fatal("unexpected frame:", got.Rect, got.Pix)
+	}
+}
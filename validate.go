@@ -0,0 +1,445 @@
+package gif
+
+import (
+	"bufio"
+	"compress/lzw"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Severity classifies an Issue found by Validate.
+type Severity int
+
+const (
+	// Hazard is permitted, or at least commonly tolerated, but decoders disagree on how to
+	// render it.
+	Hazard Severity = iota
+	// Violation breaks the GIF89a specification.
+	Violation
+)
+
+func (s Severity) String() string {
+	if s == Violation {
+		return "violation"
+	}
+	return "hazard"
+}
+
+// Issue is a spec violation or compatibility hazard found by Validate.
+type Issue struct {
+	Offset   int64 // Byte offset of the block containing the issue.
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("0x%.6x: %s: %s", i.Offset, i.Severity, i.Message)
+}
+
+// Validate walks the GIF stream read from r one block at a time and reports, in stream order,
+// the spec violations and compatibility hazards that the decoder either rejects or silently
+// works around. Unlike the decoder, it continues past malformed blocks wherever the block
+// structure allows. The returned error is only non-nil if reading from r fails.
+func Validate(r io.Reader) ([]Issue, error) {
+	rr, ok := r.(reader)
+	if !ok {
+		rr = bufio.NewReader(r)
+	}
+	v := &validator{cr: &countingReader{r: rr}, transparent: -1}
+	v.d.r = v.cr
+	err := v.validate()
+	if err == io.ErrUnexpectedEOF {
+		v.report(Violation, "unexpected end of data")
+		err = nil
+	}
+	if v.frames > 1 {
+		for _, off := range v.shortDelays {
+			v.issues = append(v.issues, Issue{off, Hazard, "frame delay below 2/100s, which browsers play as 10/100s"})
+		}
+	}
+	sort.SliceStable(v.issues, func(i, j int) bool { return v.issues[i].Offset < v.issues[j].Offset })
+	return v.issues, err
+}
+
+// countingReader tracks the offset into the stream.
+type countingReader struct {
+	r reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+type validator struct {
+	d      decoder
+	cr     *countingReader
+	issues []Issue
+	offset int64 // offset of the current block
+
+	version       string
+	width, height int
+	global        int // number of global color table entries
+	frames        int
+	shortDelays   []int64
+	netscape      bool
+	extensions87a bool
+
+	// From the pending graphic control extension.
+	gce         bool
+	gceOffset   int64
+	gceReported bool
+	delay       int
+	transparent int
+
+	pix [4096]byte
+}
+
+func (v *validator) report(s Severity, format string, args ...any) {
+	v.issues = append(v.issues, Issue{v.offset, s, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate() error {
+	err := readFull(v.d.r, v.d.tmp[:13])
+	if err != nil {
+		return err
+	}
+	v.version = string(v.d.tmp[:6])
+	if v.version != "GIF87a" && v.version != "GIF89a" {
+		v.report(Violation, "unrecognized signature %q", v.version)
+		return nil
+	}
+	v.width = int(readUint16(v.d.tmp[6:8]))
+	v.height = int(readUint16(v.d.tmp[8:10]))
+	if v.width == 0 || v.height == 0 {
+		v.report(Hazard, "logical screen %dx%d is empty; decoders disagree on whether to use the first frame's size", v.width, v.height)
+	}
+	if fields := v.d.tmp[10]; fields&fColorTable != 0 {
+		bg := v.d.tmp[11]
+		if v.global, err = v.colorTable(fields); err != nil {
+			return err
+		}
+		if int(bg) >= v.global {
+			v.report(Hazard, "background index %d outside global color table of %d entries", bg, v.global)
+		}
+	}
+
+	for {
+		v.offset = v.cr.n
+		c, err := v.d.r.ReadByte()
+		if err == io.EOF {
+			v.unusedControl(Violation)
+			v.report(Violation, "missing trailer")
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch c {
+		case sExtension:
+			err = v.extension()
+		case sImageDescriptor:
+			err = v.image()
+		case sTrailer:
+			v.unusedControl(Violation)
+			if v.frames == 0 {
+				v.report(Violation, "no image data")
+			}
+			n, err := io.Copy(io.Discard, v.d.r)
+			if n > 0 {
+				v.report(Hazard, "%d bytes after trailer", n)
+			}
+			return err
+		default:
+			v.report(Violation, "unknown block type 0x%.2x", c)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unusedControl reports a pending graphic control extension that is not followed by a graphic
+// rendering block.
+func (v *validator) unusedControl(s Severity) {
+	if !v.gce || v.gceReported {
+		return
+	}
+	v.issues = append(v.issues, Issue{v.gceOffset, s, "graphic control extension not followed by a graphic block"})
+	v.gceReported = true
+}
+
+// graphicBlock clears the graphic control extension consumed by a graphic rendering block.
+func (v *validator) graphicBlock() {
+	v.gce, v.gceReported = false, false
+	v.delay, v.transparent = 0, -1
+}
+
+func (v *validator) extension() error {
+	label, err := readByte(v.d.r)
+	if err != nil {
+		return err
+	}
+	if v.version == "GIF87a" && !v.extensions87a {
+		v.report(Violation, "extension block in a GIF87a stream")
+		v.extensions87a = true
+	}
+
+	switch label {
+	case eGraphicControl:
+		return v.graphicControl()
+
+	case eText:
+		n, err := readByte(v.d.r)
+		if err != nil {
+			return err
+		}
+		if n != 12 {
+			v.report(Violation, "plain text extension block size %d, want 12", n)
+		}
+		if err := readFull(v.d.r, v.d.tmp[:n]); err != nil {
+			return err
+		}
+		v.report(Hazard, "plain text extension, which most decoders ignore")
+		v.graphicBlock()
+		return v.subBlocks(nil)
+
+	case eComment:
+		// Extensions between a graphic control extension and its graphic block are commonly
+		// tolerated, so these are only hazards.
+		v.unusedControl(Hazard)
+		reported := false
+		return v.subBlocks(func(b []byte) {
+			for _, c := range b {
+				if c > 0x7f && !reported {
+					v.report(Hazard, "comment contains non-ASCII byte 0x%.2x", c)
+					reported = true
+				}
+			}
+		})
+
+	case eApplication:
+		v.unusedControl(Hazard)
+		n, err := readByte(v.d.r)
+		if err != nil {
+			return err
+		}
+		if n != 11 {
+			v.report(Hazard, "application extension block size %d, want 11", n)
+		}
+		if err := readFull(v.d.r, v.d.tmp[:n]); err != nil {
+			return err
+		}
+		if string(v.d.tmp[:n]) != "NETSCAPE2.0" {
+			return v.subBlocks(nil)
+		}
+		if v.netscape {
+			v.report(Hazard, "duplicate NETSCAPE2.0 extension; decoders disagree on which loop count applies")
+		} else if v.frames > 0 {
+			v.report(Hazard, "NETSCAPE2.0 extension after the first frame, which some decoders ignore")
+		}
+		v.netscape = true
+		first := true
+		return v.subBlocks(func(b []byte) {
+			if first && (len(b) != 3 || b[0] != 1) {
+				v.report(Hazard, "NETSCAPE2.0 extension without a loop count sub-block")
+			}
+			first = false
+		})
+
+	default:
+		v.unusedControl(Hazard)
+		v.report(Hazard, "unknown extension 0x%.2x", label)
+		return v.subBlocks(nil)
+	}
+}
+
+func (v *validator) graphicControl() error {
+	v.unusedControl(Violation)
+	n, err := readByte(v.d.r)
+	if err != nil {
+		return err
+	}
+	if err := readFull(v.d.r, v.d.tmp[:n]); err != nil {
+		return err
+	}
+	v.graphicBlock()
+	v.gce, v.gceOffset = true, v.offset
+	if n != 4 {
+		v.report(Violation, "graphic control extension block size %d, want 4", n)
+	}
+	if n >= 4 {
+		flags := v.d.tmp[0]
+		if disposal := (flags & gcDisposalMethodMask) >> 2; disposal > DisposalPrevious {
+			v.report(Hazard, "reserved disposal method %d", disposal)
+		}
+		v.delay = int(readUint16(v.d.tmp[1:3]))
+		if flags&gcTransparentColorSet != 0 {
+			v.transparent = int(v.d.tmp[3])
+		}
+	}
+	terminated := true
+	if err := v.subBlocks(func([]byte) { terminated = false }); err != nil {
+		return err
+	}
+	if !terminated {
+		v.report(Violation, "graphic control extension missing block terminator")
+	}
+	return nil
+}
+
+func (v *validator) image() error {
+	if err := readFull(v.d.r, v.d.tmp[:9]); err != nil {
+		return err
+	}
+	left := int(readUint16(v.d.tmp[0:2]))
+	top := int(readUint16(v.d.tmp[2:4]))
+	width := int(readUint16(v.d.tmp[4:6]))
+	height := int(readUint16(v.d.tmp[6:8]))
+	fields := v.d.tmp[8]
+
+	if left+width > v.width || top+height > v.height {
+		v.report(Violation, "frame %dx%d at %d,%d outside logical screen %dx%d", width, height, left, top, v.width, v.height)
+	}
+	if width == 0 || height == 0 {
+		v.report(Hazard, "frame %dx%d is empty", width, height)
+	}
+	n := v.global
+	if fields&fColorTable != 0 {
+		var err error
+		if n, err = v.colorTable(fields); err != nil {
+			return err
+		}
+	} else if n == 0 {
+		v.report(Violation, "frame has no color table")
+	}
+	if v.transparent >= 0 && n > 0 && v.transparent >= n {
+		v.report(Violation, "transparent index %d outside color table of %d entries", v.transparent, n)
+	}
+	if v.delay < 2 {
+		v.shortDelays = append(v.shortDelays, v.offset)
+	}
+	v.graphicBlock()
+	v.frames++
+
+	litWidth, err := readByte(v.d.r)
+	if err != nil {
+		return err
+	}
+	if litWidth < 2 || litWidth > 8 {
+		v.report(Violation, "LZW minimum code size %d out of range", litWidth)
+		return v.subBlocks(nil)
+	}
+	return v.imageData(int(litWidth), width*height, n)
+}
+
+// imageData decompresses pixels in chunks, checking them against the color table size without
+// holding the whole frame.
+func (v *validator) imageData(litWidth, remaining, colors int) error {
+	br := &blockReader{d: &v.d}
+	lzwr := lzw.NewReader(br, lzw.LSB, litWidth)
+	defer lzwr.Close()
+
+	want, badPixel := remaining, false
+	for remaining > 0 {
+		n, err := io.ReadFull(lzwr, v.pix[:min(len(v.pix), remaining)])
+		if colors > 0 && colors < 256 && !badPixel {
+			for _, c := range v.pix[:n] {
+				if int(c) >= colors {
+					v.report(Violation, "pixel value %d outside color table of %d entries", c, colors)
+					badPixel = true
+					break
+				}
+			}
+		}
+		remaining -= n
+		if err != nil {
+			if br.err != nil && br.err != io.EOF {
+				return br.err
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				v.report(Violation, "image data ends after %d of %d pixels", want-remaining, want)
+			} else {
+				v.report(Violation, "invalid image data: %v", err)
+			}
+			return v.drain(br)
+		}
+	}
+
+	// The LZW stream should now end with an End of Information code.
+	n, err := lzwr.Read(v.pix[:1])
+	if br.err != nil && br.err != io.EOF {
+		return br.err
+	}
+	if n != 0 {
+		v.report(Violation, "image data has more than %d pixels", want)
+		return v.drain(br)
+	} else if err == io.ErrUnexpectedEOF {
+		// See https://golang.org/issue/9856.
+		v.report(Hazard, "image data missing LZW end code")
+	} else if err != io.EOF {
+		v.report(Violation, "invalid image data: %v", err)
+		return v.drain(br)
+	}
+
+	// Some encoders leave bytes after the LZW data, which the decoder tolerates up to one
+	// sub-block's worth of. See https://golang.org/issue/16146.
+	extra := int(br.j - br.i)
+	for br.err == nil {
+		br.fill()
+		extra += int(br.j)
+	}
+	if br.err != io.EOF {
+		return br.err
+	}
+	if extra > 0 {
+		v.report(Violation, "%d bytes after LZW end code", extra)
+	}
+	return nil
+}
+
+// colorTable skips a color table, returning its number of entries.
+func (v *validator) colorTable(fields byte) (int, error) {
+	n := 1 << (1 + uint(fields&fColorTableBitsMask))
+	return n, readFull(v.d.r, v.d.tmp[:3*n])
+}
+
+// drain skips the remaining image data sub-blocks.
+func (v *validator) drain(br *blockReader) error {
+	for br.err == nil {
+		br.fill()
+	}
+	if br.err == io.EOF {
+		return nil
+	}
+	return br.err
+}
+
+// subBlocks reads data sub-blocks up to and including the block terminator, passing the
+// contents of each to f if not nil.
+func (v *validator) subBlocks(f func(b []byte)) error {
+	for {
+		n, err := v.d.readBlock()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if f != nil {
+			f(v.d.tmp[:n])
+		}
+	}
+}
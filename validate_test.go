@@ -0,0 +1,82 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	// image returns an image descriptor with the given bounds and data holding the given pixels.
+	image := func(left, top, width, height byte, pix ...byte) string {
+		enc := lzwEncode(pix)
+		return "\x2c" + string([]byte{left, 0, top, 0, width, 0, height, 0, 0, 2, byte(len(enc))}) + string(enc) + "\x00"
+	}
+	gce := func(flags, delay, transparent byte) string {
+		return "\x21\xf9\x04" + string([]byte{flags, delay, 0, transparent}) + "\x00"
+	}
+	netscape := "\x21\xff\x0bNETSCAPE2.0\x03\x01\x00\x00\x00"
+	frame := image(0, 0, 2, 1, 0, 1)
+	enc := lzwEncode([]byte{0, 1})
+	extra := "\x2c\x00\x00\x00\x00\x02\x00\x01\x00\x00\x02" + string(byte(len(enc)+2)) + string(enc) + "\x02\x02\x00"
+
+	testCases := []struct {
+		name     string
+		gif      string
+		severity Severity
+		want     string // substring of the only issue, or empty for none
+	}{
+		{"valid", headerStr + paletteStr + netscape + gce(0, 10, 0) + frame + gce(0, 10, 0) + frame + trailerStr, 0, ""},
+		{"single zero delay", headerStr + paletteStr + frame + trailerStr, 0, ""},
+		{"outside screen", headerStr + paletteStr + image(1, 0, 2, 1, 0, 1) + trailerStr, Violation, "outside logical screen"},
+		{"transparent index", headerStr + paletteStr + gce(1, 0, 2) + frame + trailerStr, Violation, "transparent index 2"},
+		{"pixel outside palette", headerStr + paletteStr + image(0, 0, 2, 1, 0, 2) + trailerStr, Violation, "pixel value 2"},
+		{"missing trailer", headerStr + paletteStr + frame, Violation, "missing trailer"},
+		{"truncated", headerStr + paletteStr + frame[:8], Violation, "unexpected end of data"},
+		{"not enough pixels", headerStr + paletteStr + image(0, 0, 2, 1, 0) + trailerStr, Violation, "ends after 1 of 2 pixels"},
+		{"too many pixels", headerStr + paletteStr + image(0, 0, 2, 1, 0, 1, 1) + trailerStr, Violation, "more than 2 pixels"},
+		{"extra LZW bytes", headerStr + paletteStr + extra + trailerStr, Violation, "2 bytes after LZW end code"},
+		{"zero delays", headerStr + paletteStr + gce(0, 10, 0) + frame + gce(0, 0, 0) + frame + trailerStr, Hazard, "frame delay"},
+		{"non-ASCII comment", headerStr + paletteStr + "\x21\xfe\x02h\xe9\x00" + frame + trailerStr, Hazard, "non-ASCII byte 0xe9"},
+		{"duplicate netscape", headerStr + paletteStr + netscape + netscape + frame + trailerStr, Hazard, "duplicate NETSCAPE2.0"},
+		{"control before trailer", headerStr + paletteStr + frame + gce(0, 0, 0) + trailerStr, Violation, "not followed by a graphic block"},
+		{"control before comment", headerStr + paletteStr + gce(0, 0, 0) + "\x21\xfe\x01x\x00" + frame + trailerStr, Hazard, "not followed by a graphic block"},
+		{"unknown block", headerStr + paletteStr + frame + "\x99", Violation, "unknown block type 0x99"},
+		{"bad signature", "GIF88a" + headerStr[6:] + paletteStr + frame + trailerStr, Violation, "unrecognized signature"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issues, err := Validate(strings.NewReader(tc.gif))
+			if err != nil {
+				t.Fatal("Validate:", err)
+			}
+			if tc.want == "" {
+				if len(issues) != 0 {
+					t.Fatalf("unexpected issues: %v", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].Severity != tc.severity || !strings.Contains(issues[0].Message, tc.want) {
+				t.Fatalf("got %v, want one %s containing %q", issues, tc.severity, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateEncoded(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{black, white})
+	buf := &bytes.Buffer{}
+	g := &GIF{Image: []*image.Paletted{pm, pm}, Delay: []int{5, 5}, LoopCount: 2}
+	if err := EncodeAll(buf, g); err != nil {
+		t.Fatal("EncodeAll:", err)
+	}
+	issues, err := Validate(buf)
+	if err != nil {
+		t.Fatal("Validate:", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+}